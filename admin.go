@@ -0,0 +1,292 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AdminHandler - http.Handler to change levels of default and registered loggers at runtime,
+// flush or reopen their log files and read their stats. the default logger is "global" and
+// registered ones are components by name. mount it on a mux like
+//
+//	mux.Handle("/debug/klyn/", http.StripPrefix("/debug/klyn", klog.AdminHandler()))
+//
+// bodies and responses are json:
+//
+//	GET    /levels         {"global":"info","components":{"audit":"warn"}}
+//	PUT    /levels         {"global":"debug","components":{"audit":"warn","billing":""}} merged,
+//	                       loggers left out are not changed, "" makes component follow global level
+//	GET    /levels/{name}  {"level":"warn"}
+//	PUT    /levels/{name}  {"level":"debug"}, "all" or "0" logs everything
+//	DELETE /levels/{name}  component follows global level, later changes of it included
+//	POST   /flush          write cached records into log files and sinks, ?logger={name} for one
+//	POST   /reopen         reopen log files moved away like by logrotate, ?logger={name} for one
+//	GET    /stats          {"global":{"written":10,...},"components":{"audit":{...}}}
+//
+// level "0" means all records are logged. loggers which are not *KlynLog are left out,
+// and default logger is created if not yet.
+func AdminHandler() http.Handler {
+	return adminHandler{}
+}
+
+type adminHandler struct{}
+
+type levelBody struct {
+	Level string `json:"level"`
+}
+
+type levelsBody struct {
+	Global     string            `json:"global,omitempty"`
+	Components map[string]string `json:"components"`
+}
+
+type statsBody struct {
+	Global     *Stats           `json:"global,omitempty"`
+	Components map[string]Stats `json:"components"`
+}
+
+func (h adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "levels":
+		h.levels(w, r)
+	case strings.HasPrefix(path, "levels/"):
+		h.level(w, r, strings.TrimPrefix(path, "levels/"))
+	case path == "flush", path == "reopen":
+		h.action(w, r, path)
+	case path == "stats":
+		h.stats(w, r)
+	default:
+		writeAdminError(w, http.StatusNotFound, "no route %s", r.URL.Path)
+	}
+}
+
+// loggers - default logger and registered ones which are *KlynLog, global is nil if default is not
+func (h adminHandler) loggers() (global *KlynLog, components map[string]*KlynLog) {
+	global, _ = Default().(*KlynLog)
+
+	components = make(map[string]*KlynLog)
+	for name, l := range registered() {
+		if kl, ok := l.(*KlynLog); ok {
+			components[name] = kl
+		}
+	}
+
+	return
+}
+
+func (h adminHandler) levels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if !h.mergeLevels(w, r) {
+			return
+		}
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+		return
+	}
+
+	global, components := h.loggers()
+	body := levelsBody{Components: make(map[string]string, len(components))}
+	if global != nil {
+		body.Global = global.Level().String()
+	}
+	for name, kl := range components {
+		body.Components[name] = kl.Level().String()
+	}
+
+	writeAdminJSON(w, http.StatusOK, body)
+}
+
+// mergeLevels - set levels of global and components in body, all are checked before any is set
+func (h adminHandler) mergeLevels(w http.ResponseWriter, r *http.Request) bool {
+	var body levelsBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid body: %v", err)
+		return false
+	}
+
+	global, components := h.loggers()
+	var globalLevel Level
+	if body.Global != "" {
+		if global == nil {
+			writeAdminError(w, http.StatusNotFound, "default logger is not *KlynLog")
+			return false
+		}
+
+		l, err := ParseLevel(body.Global)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, "unknown level %q, want trace, debug, info, warn, error, fatal, all or a number", body.Global)
+			return false
+		}
+		globalLevel = l
+	}
+
+	// nil level follows global
+	levels := make(map[*KlynLog]*Level, len(body.Components))
+	for name, s := range body.Components {
+		kl, ok := components[name]
+		if !ok {
+			writeAdminError(w, http.StatusNotFound, "no logger %q", name)
+			return false
+		}
+
+		if s == "" {
+			levels[kl] = nil
+			continue
+		}
+
+		l, err := ParseLevel(s)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, "unknown level %q of %s, want trace, debug, info, warn, error, fatal, all or a number", s, name)
+			return false
+		}
+		levels[kl] = &l
+	}
+
+	if body.Global != "" {
+		global.SetLevel(globalLevel)
+	}
+	for kl, l := range levels {
+		if l == nil {
+			kl.followDefaultLevel()
+		} else {
+			kl.SetLevel(*l)
+		}
+	}
+
+	return true
+}
+
+func (h adminHandler) level(w http.ResponseWriter, r *http.Request, name string) {
+	_, components := h.loggers()
+	kl, ok := components[name]
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, "no logger %q", name)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		l, ok := readLevel(w, r)
+		if !ok {
+			return
+		}
+		kl.SetLevel(l)
+	case http.MethodDelete:
+		kl.followDefaultLevel()
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, levelBody{Level: kl.Level().String()})
+}
+
+func (h adminHandler) action(w http.ResponseWriter, r *http.Request, action string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	global, components := h.loggers()
+	var targets []*KlynLog
+	if name := r.URL.Query().Get("logger"); name != "" {
+		kl, ok := components[name]
+		if !ok {
+			writeAdminError(w, http.StatusNotFound, "no logger %q", name)
+			return
+		}
+		targets = append(targets, kl)
+	} else {
+		if global != nil {
+			targets = append(targets, global)
+		}
+		for _, kl := range components {
+			// default logger may be registered too
+			if kl != global {
+				targets = append(targets, kl)
+			}
+		}
+	}
+
+	for _, kl := range targets {
+		var err error
+		if action == "flush" {
+			err = kl.Flush()
+		} else {
+			err = kl.Reopen()
+		}
+
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, "%s: %v", action, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h adminHandler) stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	global, components := h.loggers()
+	body := statsBody{Components: make(map[string]Stats, len(components))}
+	if global != nil {
+		s := global.Stats()
+		body.Global = &s
+	}
+	for name, kl := range components {
+		body.Components[name] = kl.Stats()
+	}
+
+	writeAdminJSON(w, http.StatusOK, body)
+}
+
+// readLevel - level of request body, bad request is responded if invalid
+func readLevel(w http.ResponseWriter, r *http.Request) (Level, bool) {
+	var body levelBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid body: %v", err)
+		return 0, false
+	}
+
+	l, err := ParseLevel(body.Level)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, "unknown level %q, want trace, debug, info, warn, error, fatal, all or a number", body.Level)
+		return 0, false
+	}
+
+	return l, true
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed, want %s", strings.Join(methods, " or "))
+}
+
+func writeAdminError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeAdminJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(b, '\n'))
+}
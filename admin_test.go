@@ -0,0 +1,181 @@
+package klynlog
+
+import (
+	stdjson "encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+func adminDo(t *testing.T, h http.Handler, method, path, body string, status int, v interface{}) {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != status {
+		t.Fatalf("%s %s: want status %d, got %d %s", method, path, status, w.Code, w.Body)
+	}
+
+	if v != nil {
+		if err := stdjson.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+func TestAdminMergeLevels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	global := NewLogger(&LoggerConfig{Prefix: "GLOBAL", Dir: dir, FlushMode: consts.FlushModeByDuration, Level: LoggerLevelInfo}).(*KlynLog)
+	defer global.Close()
+	old := Default()
+	SetDefault(global)
+	defer SetDefault(old)
+
+	for _, name := range []string{"audit", "billing"} {
+		kl := NewLogger(&LoggerConfig{Prefix: strings.ToUpper(name), Dir: dir, FlushMode: consts.FlushModeByDuration}).(*KlynLog)
+		defer kl.Close()
+		Register(name, kl)
+		defer Unregister(name)
+	}
+
+	h := AdminHandler()
+	var levels levelsBody
+	adminDo(t, h, "PUT", "/levels", `{"components":{"audit":"debug"}}`, http.StatusOK, &levels)
+	adminDo(t, h, "PUT", "/levels", `{"components":{"billing":"error"}}`, http.StatusOK, &levels)
+	want := map[string]string{"audit": "debug", "billing": "error"}
+	if levels.Global != "info" || !reflect.DeepEqual(levels.Components, want) {
+		t.Fatalf("want both components kept, got %+v", levels)
+	}
+
+	// empty level resets component to global level
+	adminDo(t, h, "PUT", "/levels", `{"components":{"audit":""}}`, http.StatusOK, &levels)
+	if levels.Components["audit"] != "info" || levels.Components["billing"] != "error" {
+		t.Fatalf("want audit reset only, got %+v", levels)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	global := NewLogger(&LoggerConfig{Prefix: "GLOBAL", Dir: dir, FlushMode: consts.FlushModeByDuration}).(*KlynLog)
+	defer global.Close()
+	audit := NewLogger(&LoggerConfig{Prefix: "AUDIT", Dir: dir, FlushMode: consts.FlushModeBySize,
+		Level: LoggerLevelInfo, Sampling: &Sampling{Initial: 1}}).(*KlynLog)
+	defer audit.Close()
+
+	old := Default()
+	SetDefault(global)
+	defer SetDefault(old)
+	Register("audit", audit)
+	defer Unregister("audit")
+	Register("observer", new(levelLogger))
+	defer Unregister("observer")
+
+	h := AdminHandler()
+
+	var levels levelsBody
+	adminDo(t, h, "GET", "/levels", "", http.StatusOK, &levels)
+	if levels.Global != "0" || len(levels.Components) != 1 || levels.Components["audit"] != "info" {
+		t.Fatalf("unexpected levels %+v", levels)
+	}
+
+	var level levelBody
+	adminDo(t, h, "PUT", "/levels/audit", `{"level":"debug"}`, http.StatusOK, &level)
+	if level.Level != "debug" || audit.Level() != LoggerLevelDebug || global.Level() != 0 {
+		t.Fatalf("want only audit level debug, got %s", level.Level)
+	}
+
+	adminDo(t, h, "PUT", "/levels", `{"global":"warn"}`, http.StatusOK, &levels)
+	if levels.Global != "warn" || levels.Components["audit"] != "debug" || audit.Level() != LoggerLevelDebug {
+		t.Fatalf("want only global level changed, got %+v", levels)
+	}
+
+	adminDo(t, h, "DELETE", "/levels/audit", "", http.StatusOK, &level)
+	if level.Level != "warn" || audit.Level() != LoggerLevelWarn {
+		t.Fatalf("want audit reset to global level, got %s", level.Level)
+	}
+	adminDo(t, h, "PUT", "/levels", `{"global":"error"}`, http.StatusOK, &levels)
+	if levels.Components["audit"] != "error" || audit.Level() != LoggerLevelError {
+		t.Fatalf("want audit following global level, got %+v", levels)
+	}
+
+	// every level returned can be set back
+	adminDo(t, h, "PUT", "/levels/audit", `{"level":"0"}`, http.StatusOK, &level)
+	if level.Level != "0" || audit.Level() != 0 || global.Level() != LoggerLevelError {
+		t.Fatalf("want audit logging everything, got %s", level.Level)
+	}
+	adminDo(t, h, "PUT", "/levels", `{"global":"all"}`, http.StatusOK, &levels)
+	if levels.Global != "0" {
+		t.Fatalf("want global logging everything, got %+v", levels)
+	}
+	adminDo(t, h, "PUT", "/levels/audit", `{"level":"warn"}`, http.StatusOK, &level)
+
+	adminDo(t, h, "PUT", "/levels", `{"components":{"audit":"verbose"}}`, http.StatusBadRequest, nil)
+	adminDo(t, h, "PUT", "/levels", `{"components":{"observer":"info"}}`, http.StatusNotFound, nil)
+
+	adminDo(t, h, "PUT", "/levels/audit", `{"level":"verbose"}`, http.StatusBadRequest, nil)
+	adminDo(t, h, "GET", "/levels/observer", "", http.StatusNotFound, nil)
+	adminDo(t, h, "DELETE", "/levels", "", http.StatusMethodNotAllowed, nil)
+	adminDo(t, h, "GET", "/flush", "", http.StatusMethodNotAllowed, nil)
+	adminDo(t, h, "GET", "/unknown", "", http.StatusNotFound, nil)
+
+	audit.Info("discarded by level")
+	audit.Warn("written")
+	audit.Warn("sampled")
+
+	var stats statsBody
+	adminDo(t, h, "GET", "/stats", "", http.StatusOK, &stats)
+	if s := stats.Components["audit"]; s.Written != 0 || s.Dropped != 1 || s.CacheLength == 0 || !s.LastFlush.IsZero() {
+		t.Fatalf("unexpected stats before flush %+v", s)
+	}
+
+	adminDo(t, h, "POST", "/flush?logger=audit", "", http.StatusNoContent, nil)
+	adminDo(t, h, "POST", "/flush?logger=missing", "", http.StatusNotFound, nil)
+
+	adminDo(t, h, "GET", "/stats", "", http.StatusOK, &stats)
+	s := stats.Components["audit"]
+	if s.Written != 1 || s.CacheLength != 0 || s.Bytes == 0 || time.Since(s.LastFlush) > time.Minute {
+		t.Fatalf("unexpected stats after flush %+v", s)
+	}
+	if stats.Global == nil || stats.Global.Written != 0 {
+		t.Fatalf("unexpected global stats %+v", stats.Global)
+	}
+
+	// log file moved away, like by logrotate, is not written after reopen
+	day := time.Now().Format(consts.LogFileDateFormat)
+	name := filepath.Join(dir, "AUDIT-"+day+".log")
+	if err = os.Rename(name, name+".moved"); err != nil {
+		t.Fatal(err)
+	}
+
+	adminDo(t, h, "POST", "/reopen", "", http.StatusNoContent, nil)
+	audit.Error("after reopen")
+	if err = audit.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `message:"after reopen"`) {
+		t.Fatalf("unexpected reopened log file:\n%s", b)
+	}
+}
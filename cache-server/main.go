@@ -1,15 +1,47 @@
 package main
 
 import (
-	"sync"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/yusank/klyn-log/lib/raft"
 )
 
-type cacheManager struct {
-	m sync.Map
-}
-
 func main() {
-	raft.Server()
+	cfg := raft.DefaultConfig()
+	var node = flag.String("node", "node1", "raft node name")
+	flag.StringVar(&cfg.HTTPAddr, "http", cfg.HTTPAddr, "Http address")
+	flag.StringVar(&cfg.RaftAddr, "raft", cfg.RaftAddr, "raft tcp address")
+	flag.BoolVar(&cfg.Bootstrap, "leader", false, "start as raft cluster")
+	flag.StringVar(&cfg.JoinAddr, "join", "", "join address for raft cluster")
+	flag.BoolVar(&cfg.Nonvoter, "nonvoter", false, "join raft cluster as non-voting learner")
+	flag.StringVar(&cfg.Forward, "forward", cfg.Forward, "how followers forward writes to leader: proxy or redirect")
+	flag.BoolVar(&cfg.TransferLeadership, "transfer", true, "transfer leadership to another node on shutdown")
+	var timeout = flag.Duration("shutdown-timeout", 10*time.Second, "max time waiting in-flight requests on shutdown")
+	flag.Parse()
+	cfg.DataDir = "./" + *node
+
+	server, err := raft.NewServer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = server.Start(); err != nil {
+		log.Fatal(err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	log.Printf("received %s, shutting down", <-sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err = server.Shutdown(ctx); err != nil {
+		log.Fatal(err)
+	}
 }
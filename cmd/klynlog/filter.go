@@ -0,0 +1,201 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	klynlog "github.com/yusank/klyn-log"
+	"github.com/yusank/klyn-log/reader"
+)
+
+// stringsFlag - flag can be set many times
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+type filterFlags struct {
+	level string
+	since string
+	until string
+	where stringsFlag
+}
+
+func (f *filterFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.level, "level", "", "minimum level: trace, debug, info, warn, error or fatal")
+	fs.StringVar(&f.since, "since", "", "records at or after time: RFC3339, 2006-01-02, '2006-01-02 15:04:05' or duration ago like 1h")
+	fs.StringVar(&f.until, "until", "", "records before time, same format as -since")
+	fs.Var(&f.where, "where", "field expression, can be repeated: key=value key!=value key~regexp key !key")
+}
+
+// query - build query from flags and extra expressions
+func (f *filterFlags) query(exprs []string) (q reader.Query, err error) {
+	if f.level != "" {
+		if q.MinLevel, err = klynlog.ParseLevel(f.level); err != nil {
+			return
+		}
+	}
+
+	now := time.Now()
+	if q.Since, err = parseTime(f.since, now); err != nil {
+		return
+	}
+
+	if q.Until, err = parseTime(f.until, now); err != nil {
+		return
+	}
+
+	for _, expr := range append(append([]string(nil), f.where...), exprs...) {
+		p, err := parseExpr(expr)
+		if err != nil {
+			return q, err
+		}
+
+		q.Where = append(q.Where, p)
+	}
+
+	return
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseTime - parse absolute time or duration before now, empty string is zero time
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// parseExpr - parse one of key=value, key!=value, key~regexp, key, !key
+func parseExpr(expr string) (reader.Predicate, error) {
+	if expr == "" || expr == "!" {
+		return nil, errors.New("empty expression")
+	}
+
+	// split on the first operator, values such as regexp may contain the others
+	switch i := strings.IndexAny(expr, "=~"); {
+	case i < 0:
+	case i > 1 && expr[i] == '=' && expr[i-1] == '!':
+		return reader.Not(reader.FieldEquals(expr[:i-1], expr[i+1:])), nil
+	case i == 0 || (i == 1 && expr[0] == '!'):
+		return nil, fmt.Errorf("invalid expression %q: missing key", expr)
+	case expr[i] == '=':
+		return reader.FieldEquals(expr[:i], expr[i+1:]), nil
+	default:
+		re, err := regexp.Compile(expr[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression %q: %v", expr, err)
+		}
+
+		return reader.FieldMatches(expr[:i], re), nil
+	}
+
+	if expr[0] == '!' {
+		return reader.Not(reader.FieldExists(expr[1:])), nil
+	}
+
+	return reader.FieldExists(expr), nil
+}
+
+// lastRecords - last n matched records of file, read backwards so large file is not scanned.
+// size is the offset records are read until.
+func lastRecords(file reader.LogFile, n int, q reader.Query) (records []*reader.Record, size int64, err error) {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	size = info.Size()
+	const chunk = 64 * 1024
+	var (
+		end  = size
+		tail []byte // incomplete line at start of last chunk
+	)
+
+	for end > 0 && len(records) < n {
+		start := end - chunk
+		if start < 0 {
+			start = 0
+		}
+
+		buf := make([]byte, end-start)
+		if _, err = f.ReadAt(buf, start); err != nil && err != io.EOF {
+			return
+		}
+		err = nil
+
+		buf = append(buf, tail...)
+		lines := bytes.Split(buf, []byte("\n"))
+		if start > 0 {
+			// first line may continue in previous chunk
+			tail, lines = lines[0], lines[1:]
+		} else {
+			tail = nil
+		}
+
+		for i := len(lines) - 1; i >= 0 && len(records) < n; i-- {
+			rec, perr := reader.ParseLine(lines[i])
+			if perr != nil {
+				continue
+			}
+
+			rec.File = file.Path
+			if rec.Time.IsZero() {
+				rec.Time = file.Day
+			}
+
+			if q.Match(rec) {
+				records = append(records, rec)
+			}
+		}
+
+		end = start
+	}
+
+	// reverse to oldest first
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+
+	return
+}
@@ -0,0 +1,267 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Command klynlog reads log files written by klyn-log.
+//
+//	klynlog grep [flags] [expr ...]     print matched records of all files of a prefix
+//	klynlog tail [-n 10] [-f] [flags]   print last records of newest file, -f follows new records across days
+//	klynlog convert [flags] [file ...]  convert lines of files or stdin between text, json and logfmt
+//
+// expr is one of key=value, key!=value, key~regexp, key or !key, key is dotted path like event.gameId.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/yusank/klyn-log/consts"
+	"github.com/yusank/klyn-log/reader"
+)
+
+const usage = `usage: klynlog <command> [flags] [args]
+
+commands:
+  grep     print records matched by flags and expressions (key=value key!=value key~regexp key !key)
+  tail     print last records of newest file, -f to follow across days
+  convert  convert lines of files or stdin into -format
+
+run 'klynlog <command> -h' for flags of command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "grep", "cat":
+		err = runGrep(args, os.Stdout)
+	case "tail":
+		err = runTail(args, os.Stdout)
+	case "convert":
+		err = runConvert(args, os.Stdin, os.Stdout)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "klynlog: unknown command %q\n%s", cmd, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "klynlog:", err)
+		os.Exit(1)
+	}
+}
+
+// options - flags shared by all commands
+type options struct {
+	dir    string
+	prefix string
+	filter filterFlags
+	out    outputFlags
+}
+
+func newFlagSet(name string, o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&o.dir, "dir", consts.DefaultLogDir, "log directory")
+	fs.StringVar(&o.prefix, "prefix", "KLYN", "prefix of log files")
+	o.filter.register(fs)
+	o.out.register(fs)
+	return fs
+}
+
+func runGrep(args []string, w io.Writer) error {
+	var o options
+	fs := newFlagSet("grep", &o)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	q, err := o.filter.query(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	p, err := o.out.printer(w)
+	if err != nil {
+		return err
+	}
+	defer p.flush()
+
+	r, err := reader.Open(o.dir, o.prefix, q)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for r.Next() {
+		if err = p.print(r.Record()); err != nil {
+			return err
+		}
+	}
+
+	return r.Err()
+}
+
+func runTail(args []string, w io.Writer) error {
+	var (
+		o      options
+		n      int
+		follow bool
+	)
+
+	fs := newFlagSet("tail", &o)
+	fs.IntVar(&n, "n", 10, "number of last records to print")
+	fs.BoolVar(&follow, "f", false, "follow new records, switch to file of next day once created")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	q, err := o.filter.query(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	p, err := o.out.printer(w)
+	if err != nil {
+		return err
+	}
+	defer p.flush()
+
+	files, err := reader.Files(o.dir, o.prefix)
+	if err != nil {
+		return err
+	}
+
+	var pos *reader.Position
+	if len(files) > 0 {
+		newest := files[len(files)-1]
+		records, size, err := lastRecords(newest, n, q)
+		if err != nil {
+			return err
+		}
+
+		for _, rec := range records {
+			if err = p.print(rec); err != nil {
+				return err
+			}
+		}
+
+		pos = &reader.Position{File: newest, Offset: size}
+	}
+
+	if !follow {
+		return nil
+	}
+
+	if pos == nil {
+		// nothing logged yet, follow from start of first file created
+		pos = &reader.Position{}
+	}
+
+	f, err := reader.Follow(o.dir, o.prefix, q, pos)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	for f.Next(ctx) {
+		if err = p.print(f.Record()); err != nil {
+			return err
+		}
+
+		// records come slowly, do not keep them in buffer
+		p.flush()
+	}
+
+	return f.Err()
+}
+
+func runConvert(args []string, stdin io.Reader, w io.Writer) error {
+	var o options
+	fs := newFlagSet("convert", &o)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// args are files to convert, filter only by flags
+	q, err := o.filter.query(nil)
+	if err != nil {
+		return err
+	}
+
+	p, err := o.out.printer(w)
+	if err != nil {
+		return err
+	}
+	defer p.flush()
+
+	convert := func(r io.Reader) error {
+		br := bufio.NewReaderSize(r, 64*1024)
+		for {
+			line, err := br.ReadBytes('\n')
+			if len(line) > 0 {
+				if rec, perr := reader.ParseLine(line); perr == nil && q.Match(rec) {
+					if err := p.print(rec); err != nil {
+						return err
+					}
+				}
+			}
+
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if fs.NArg() == 0 {
+		return convert(stdin)
+	}
+
+	for _, name := range fs.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+
+		err = convert(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(c)
+	}()
+
+	return ctx, cancel
+}
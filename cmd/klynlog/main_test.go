@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/yusank/klyn-log/reader"
+)
+
+func tempLogDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "klynlog-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestGrep(t *testing.T) {
+	dir := tempLogDir(t, map[string]string{
+		"KLYN-2018-06-01.log": `[KLYN] | TIME:2018-06-01T08:00:00.000Z | LEVEL:warn | message:{"ip":"127.0.0.1","userId":1}` + "\n" +
+			`[KLYN] | TIME:2018-06-01T09:00:00.000Z | LEVEL:info | message:{"ip":"10.0.0.1","userId":2}` + "\n" +
+			`[KLYN] | TIME:2018-06-01T10:00:00.000Z | LEVEL:error | message:{"ip":"10.0.0.2","userId":3}` + "\n",
+	})
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-level", "warn", "-format", "logfmt"},
+			"prefix=KLYN time=2018-06-01T08:00:00.000Z level=warn ip=127.0.0.1 userId=1\n" +
+				"prefix=KLYN time=2018-06-01T10:00:00.000Z level=error ip=10.0.0.2 userId=3\n"},
+		{[]string{"-format", "json", "ip~^10\\.", "userId!=3"},
+			`{"prefix":"KLYN","time":"2018-06-01T09:00:00.000Z","level":"info","message":{"ip":"10.0.0.1","userId":2}}` + "\n"},
+		{[]string{"-since", "2018-06-01T09:00:00Z", "-until", "2018-06-01T10:00:00Z", "-where", "userId"},
+			`[KLYN] | TIME:2018-06-01T09:00:00.000Z | LEVEL:info | message:{"ip":"10.0.0.1","userId":2}` + "\n"},
+		{[]string{"!userId"}, ""},
+	}
+
+	for _, c := range cases {
+		out := new(bytes.Buffer)
+		if err := runGrep(append([]string{"-dir", dir}, c.args...), out); err != nil {
+			t.Fatal(err)
+		}
+
+		if out.String() != c.want {
+			t.Fatalf("%v: want\n%s\ngot\n%s", c.args, c.want, out)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	in := `prefix=KLYN time=2018-06-01T08:00:00.000Z level=warn event.gameId=dddjs name="hello world"` + "\n"
+	out := new(bytes.Buffer)
+	if err := runConvert([]string{"-format", "text"}, strings.NewReader(in), out); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[KLYN] | TIME:2018-06-01T08:00:00.000Z | LEVEL:warn | message:{"event":{"gameId":"dddjs"},"name":"hello world"}` + "\n"
+	if out.String() != want {
+		t.Fatalf("want\n%s\ngot\n%s", want, out)
+	}
+
+	// and back again
+	back := new(bytes.Buffer)
+	if err := runConvert([]string{"-format", "logfmt"}, out, back); err != nil {
+		t.Fatal(err)
+	}
+
+	if back.String() != in {
+		t.Fatalf("want\n%s\ngot\n%s", in, back)
+	}
+}
+
+func TestLastRecords(t *testing.T) {
+	content := new(bytes.Buffer)
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(content, `[KLYN] | LEVEL:info | message:{"userId":%d}`+"\n", i)
+	}
+
+	dir := tempLogDir(t, map[string]string{"KLYN-2018-06-01.log": content.String()})
+	defer os.RemoveAll(dir)
+
+	files, err := reader.Files(dir, "KLYN")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := reader.Query{Where: []reader.Predicate{reader.FieldMatches("userId", regexp.MustCompile("0$"))}}
+	records, size, err := lastRecords(files[0], 300, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size != int64(content.Len()) || len(records) != 300 {
+		t.Fatalf("unexpected size %d, records %d", size, len(records))
+	}
+
+	for i, rec := range records {
+		if v, _ := rec.Field("userId"); fmt.Sprint(v) != fmt.Sprint(2000+i*10) {
+			t.Fatalf("record %d: unexpected userId %v", i, v)
+		}
+	}
+}
+
+func TestParseExpr(t *testing.T) {
+	rec, err := reader.ParseLine([]byte(`[KLYN] | TIME:2018-06-01T10:00:00.000+08:00 | LEVEL:warn | message:{"msg":"a=b","q":"x~y"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		expr string
+		want bool
+	}{
+		{"msg=a=b", true},
+		{"msg~a=b", true},
+		{"msg~^a=", true},
+		{"msg~b=a", false},
+		{"msg!=a=b", false},
+		{"q=x~y", true},
+		{"q!=x~y", false},
+		{"q!=x", true},
+		{"q~x~y", true},
+		{"msg", true},
+		{"!msg", false},
+	} {
+		p, err := parseExpr(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		if got := p(rec); got != c.want {
+			t.Fatalf("%s: want %v, got %v", c.expr, c.want, got)
+		}
+	}
+
+	for _, expr := range []string{"", "!", "=a", "~a", "!=a", "!~a", "msg~("} {
+		if _, err := parseExpr(expr); err == nil {
+			t.Fatalf("want error of %q", expr)
+		}
+	}
+}
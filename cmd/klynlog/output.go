@@ -0,0 +1,84 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	klynlog "github.com/yusank/klyn-log"
+	"github.com/yusank/klyn-log/reader"
+)
+
+type outputFlags struct {
+	format string
+	pretty bool
+}
+
+func (o *outputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.format, "format", "text", "output format: text, json or logfmt")
+	fs.BoolVar(&o.pretty, "pretty", false, "human readable output with indented message")
+}
+
+type printer struct {
+	w      *bufio.Writer
+	enc    klynlog.Encoder
+	pretty bool
+}
+
+func (o *outputFlags) printer(w io.Writer) (*printer, error) {
+	enc, err := klynlog.NewEncoder(o.format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &printer{w: bufio.NewWriter(w), enc: enc, pretty: o.pretty}, nil
+}
+
+func (p *printer) print(rec *reader.Record) error {
+	if p.pretty {
+		return p.printPretty(rec)
+	}
+
+	e, err := rec.Entry()
+	if err != nil {
+		return err
+	}
+
+	line, err := p.enc.Encode(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.w.Write(line)
+	return err
+}
+
+// printPretty - print like:
+// 2006-01-02 15:04:05.000 WARN  [KLYN]
+//
+//	{
+//	  "userId": 1
+//	}
+func (p *printer) printPretty(rec *reader.Record) error {
+	msg := new(bytes.Buffer)
+	if err := json.Indent(msg, rec.Message, "  ", "  "); err != nil {
+		msg.Reset()
+		msg.Write(rec.Message)
+	}
+
+	_, err := fmt.Fprintf(p.w, "%s %-5s [%s]\n  %s\n",
+		rec.Time.Format("2006-01-02 15:04:05.000"), strings.ToUpper(rec.Level.String()), rec.Prefix, msg.String())
+	return err
+}
+
+func (p *printer) flush() {
+	_ = p.w.Flush()
+}
@@ -0,0 +1,653 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"bytes"
+	"encoding"
+	stdjson "encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/yusank/klyn-log/consts"
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix - prefix of environment variables overriding config,
+// name is the upper case path of yaml keys joined by '_', like KLYN_DURABILITY_INTERVAL
+const EnvPrefix = "KLYN"
+
+// Config - logger config which can be loaded from a yaml, json or toml file
+// and environment variables:
+//
+//	prefix: KLYN
+//	dir: /var/log/game
+//	level: info
+//	encoder: json
+//	sampling:
+//	  initial: 100
+//	  thereafter: 10
+//	flush:
+//	  mode: duration
+//	durability:
+//	  mode: level
+//	  level: error
+//	rotation:
+//	  max_size: 100MB
+//	  max_age: 168h
+//	sinks:
+//	  - type: http
+//	    url: http://es:9200/_bulk
+//	    format: elastic_bulk
+type Config struct {
+	Prefix  string `json:"prefix" yaml:"prefix" toml:"prefix"`
+	Dir     string `json:"dir" yaml:"dir" toml:"dir"`
+	Level   string `json:"level" yaml:"level" toml:"level"`       // records below it are discarded, all logged if empty
+	Encoder string `json:"encoder" yaml:"encoder" toml:"encoder"` // text, json or logfmt, text if empty
+	Debug   bool   `json:"debug" yaml:"debug" toml:"debug"`
+	Spool   string `json:"spool" yaml:"spool" toml:"spool"` // path of write-ahead spool, no spool if empty
+
+	Sampling   SamplingConfig   `json:"sampling" yaml:"sampling" toml:"sampling"`
+	Flush      FlushConfig      `json:"flush" yaml:"flush" toml:"flush"`
+	Durability DurabilityConfig `json:"durability" yaml:"durability" toml:"durability"`
+	Rotation   RotationConfig   `json:"rotation" yaml:"rotation" toml:"rotation"`
+	Sinks      []SinkConfig     `json:"sinks" yaml:"sinks" toml:"sinks"`
+
+	// Metrics - set by code, not by file or environment
+	Metrics Metrics `json:"-" yaml:"-" toml:"-"`
+}
+
+// SamplingConfig - records logged per level per tick, no sampling if initial and thereafter are zero
+type SamplingConfig struct {
+	Tick       Duration `json:"tick" yaml:"tick" toml:"tick"`
+	Initial    int      `json:"initial" yaml:"initial" toml:"initial"`
+	Thereafter int      `json:"thereafter" yaml:"thereafter" toml:"thereafter"`
+}
+
+// FlushConfig - when cache is flushed into log file
+type FlushConfig struct {
+	Mode string `json:"mode" yaml:"mode" toml:"mode"` // every_log, duration or size, duration if empty
+}
+
+// DurabilityConfig - when log file is fsynced
+type DurabilityConfig struct {
+	Mode     string   `json:"mode" yaml:"mode" toml:"mode"` // none, every_flush, interval or level, none if empty
+	Interval Duration `json:"interval" yaml:"interval" toml:"interval"`
+	Level    string   `json:"level" yaml:"level" toml:"level"`
+}
+
+// RotationConfig - when log file is rotated and removed
+type RotationConfig struct {
+	MaxSize ByteSize `json:"max_size" yaml:"max_size" toml:"max_size"`
+	MaxAge  Duration `json:"max_age" yaml:"max_age" toml:"max_age"`
+}
+
+// SinkConfig - a sink of type net, syslog or http, fields not of the type are ignored
+type SinkConfig struct {
+	Type string `json:"type" yaml:"type" toml:"type"`
+
+	// net and syslog
+	Network   string   `json:"network" yaml:"network" toml:"network"`
+	Addr      string   `json:"addr" yaml:"addr" toml:"addr"`
+	Framing   string   `json:"framing" yaml:"framing" toml:"framing"` // newline, length_prefix or octet_counting
+	SpoolSize ByteSize `json:"spool_size" yaml:"spool_size" toml:"spool_size"`
+
+	// encoder of net and http records, json if empty
+	Encoder string `json:"encoder" yaml:"encoder" toml:"encoder"`
+
+	// syslog
+	Facility string `json:"facility" yaml:"facility" toml:"facility"` // kern, user, ..., local0 - local7. user if empty
+	AppName  string `json:"app_name" yaml:"app_name" toml:"app_name"`
+	Hostname string `json:"hostname" yaml:"hostname" toml:"hostname"`
+
+	// syslog: rfc5424 or rfc3164, http: ndjson, elastic_bulk or loki
+	Format string `json:"format" yaml:"format" toml:"format"`
+
+	// http
+	URL             string            `json:"url" yaml:"url" toml:"url"`
+	Headers         map[string]string `json:"headers" yaml:"headers" toml:"headers"`
+	Gzip            bool              `json:"gzip" yaml:"gzip" toml:"gzip"`
+	Index           string            `json:"index" yaml:"index" toml:"index"`
+	IndexDateFormat string            `json:"index_date_format" yaml:"index_date_format" toml:"index_date_format"`
+	Labels          map[string]string `json:"labels" yaml:"labels" toml:"labels"`
+	BatchSize       int               `json:"batch_size" yaml:"batch_size" toml:"batch_size"`
+	BatchWait       Duration          `json:"batch_wait" yaml:"batch_wait" toml:"batch_wait"`
+	MaxRetries      int               `json:"max_retries" yaml:"max_retries" toml:"max_retries"`
+	DeadLetter      string            `json:"dead_letter" yaml:"dead_letter" toml:"dead_letter"`
+}
+
+// Duration - time.Duration written like "200ms" or "1h"
+type Duration time.Duration
+
+// UnmarshalText - implement encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", b)
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalYAML - implement yaml.Unmarshaler
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	return d.UnmarshalText([]byte(s))
+}
+
+// ByteSize - size in bytes written like 1024, "512KB", "100MB" or "1GB"
+type ByteSize int64
+
+// UnmarshalText - implement encoding.TextUnmarshaler
+func (bs *ByteSize) UnmarshalText(b []byte) error {
+	s := strings.ToUpper(strings.TrimSpace(string(b)))
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %q", b)
+	}
+
+	*bs = ByteSize(n * unit)
+	return nil
+}
+
+// UnmarshalYAML - implement yaml.Unmarshaler
+func (bs *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	return bs.UnmarshalText([]byte(s))
+}
+
+// UnmarshalJSON - accept number as well as string
+func (bs *ByteSize) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := stdjson.Unmarshal(b, &s); err != nil {
+		s = string(b)
+	}
+
+	return bs.UnmarshalText([]byte(s))
+}
+
+// ConfigError - all problems found in config
+type ConfigError struct {
+	Problems []string // like `sinks[0].addr: required`
+}
+
+func (ce *ConfigError) Error() string {
+	return "klynlog: invalid config: " + strings.Join(ce.Problems, "; ")
+}
+
+func (ce *ConfigError) addf(field, format string, args ...interface{}) {
+	ce.Problems = append(ce.Problems, field+": "+fmt.Sprintf(format, args...))
+}
+
+// LoadConfig - load config file, format is told by extension: .yaml, .yml, .json or .toml.
+// KLYN_* environment variables override values of file, and config is validated.
+// empty path loads environment variables only.
+func LoadConfig(path string) (*Config, error) {
+	c := new(Config)
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if c, err = ParseConfig(b, strings.TrimPrefix(filepath.Ext(path), ".")); err != nil {
+			return nil, fmt.Errorf("%v in %s", err, path)
+		}
+	}
+
+	if err := c.ApplyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ParseConfig - parse config of format yaml, yml, json or toml. unknown keys are errors
+func ParseConfig(b []byte, format string) (*Config, error) {
+	c := new(Config)
+	var err error
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		err = yaml.UnmarshalStrict(b, c)
+	case "json":
+		dec := stdjson.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	case "toml":
+		var md toml.MetaData
+		if md, err = toml.Decode(string(b), c); err == nil {
+			if undecoded := md.Undecoded(); len(undecoded) > 0 {
+				err = fmt.Errorf("unknown key %s", undecoded[0])
+			}
+		}
+	default:
+		return nil, fmt.Errorf("klynlog: unsupported config format %q, want yaml, json or toml", format)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("klynlog: parse %s config: %v", format, err)
+	}
+
+	return c, nil
+}
+
+// ApplyEnv - override config by KLYN_* environment variables.
+// sinks can only be set by file.
+func (c *Config) ApplyEnv() error {
+	ce := new(ConfigError)
+	applyEnv(EnvPrefix, reflect.ValueOf(c).Elem(), ce)
+	if len(ce.Problems) > 0 {
+		return ce
+	}
+
+	return nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func applyEnv(prefix string, v reflect.Value, ce *ConfigError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		key := prefix + "_" + strings.ToUpper(name)
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct {
+			applyEnv(key, field, ce)
+			continue
+		}
+
+		s, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+
+		if field.Addr().Type().Implements(textUnmarshalerType) {
+			if err := field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+				ce.addf(key, "%v", err)
+			}
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(s)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				ce.addf(key, "invalid bool %q", s)
+				continue
+			}
+			field.SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				ce.addf(key, "invalid integer %q", s)
+				continue
+			}
+			field.SetInt(int64(n))
+		}
+	}
+}
+
+var (
+	flushModes = map[string]int{
+		"every_log": consts.FlushModeEveryLog,
+		"duration":  consts.FlushModeByDuration,
+		"size":      consts.FlushModeBySize,
+	}
+	durabilities = map[string]int{
+		"none":        consts.DurabilityNone,
+		"every_flush": consts.DurabilityEveryFlush,
+		"interval":    consts.DurabilityInterval,
+		"level":       consts.DurabilityLevel,
+	}
+	framings = map[string]Framing{
+		"newline":        FramingNewline,
+		"length_prefix":  FramingLengthPrefix,
+		"octet_counting": FramingOctetCounting,
+	}
+	syslogFormats = map[string]SyslogFormat{
+		"rfc5424": SyslogRFC5424,
+		"rfc3164": SyslogRFC3164,
+	}
+	syslogFacilities = map[string]SyslogFacility{
+		"kern": SyslogKern, "user": SyslogUser, "mail": SyslogMail, "daemon": SyslogDaemon,
+		"auth": SyslogAuth, "syslog": SyslogSyslog, "lpr": SyslogLpr, "news": SyslogNews,
+		"uucp": SyslogUucp, "cron": SyslogCron, "authpriv": SyslogAuthpriv, "ftp": SyslogFtp,
+		"local0": SyslogLocal0, "local1": SyslogLocal1, "local2": SyslogLocal2, "local3": SyslogLocal3,
+		"local4": SyslogLocal4, "local5": SyslogLocal5, "local6": SyslogLocal6, "local7": SyslogLocal7,
+	}
+	httpFormats = map[string]HTTPFormat{
+		"ndjson":       HTTPFormatNDJSON,
+		"elastic_bulk": HTTPFormatElasticBulk,
+		"loki":         HTTPFormatLoki,
+	}
+)
+
+// oneOf - "a, b or c" of sorted keys of map m
+func oneOf(m interface{}) string {
+	keys := reflect.ValueOf(m).MapKeys()
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, k.String())
+	}
+	sort.Strings(names)
+
+	if len(names) == 1 {
+		return names[0]
+	}
+
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+func checkEnum(ce *ConfigError, field, value string, m interface{}) {
+	if value == "" {
+		return
+	}
+
+	if !reflect.ValueOf(m).MapIndex(reflect.ValueOf(value)).IsValid() {
+		ce.addf(field, "unknown %q, want %s", value, oneOf(m))
+	}
+}
+
+// Validate - check every value, all problems are reported together in a *ConfigError
+func (c *Config) Validate() error {
+	ce := new(ConfigError)
+	if strings.ContainsAny(c.Prefix, `/\`) {
+		ce.addf("prefix", "%q contains path separator", c.Prefix)
+	}
+
+	if c.Level != "" {
+		if _, err := ParseLevel(c.Level); err != nil {
+			ce.addf("level", "unknown %q, want all, trace, debug, info, warn, error, fatal or a number", c.Level)
+		}
+	}
+
+	if _, err := NewEncoder(c.Encoder); err != nil {
+		ce.addf("encoder", "unknown %q, want text, json or logfmt", c.Encoder)
+	}
+
+	if c.Sampling.Tick < 0 {
+		ce.addf("sampling.tick", "negative %v", time.Duration(c.Sampling.Tick))
+	}
+	if c.Sampling.Initial < 0 {
+		ce.addf("sampling.initial", "negative %d", c.Sampling.Initial)
+	}
+	if c.Sampling.Thereafter < 0 {
+		ce.addf("sampling.thereafter", "negative %d", c.Sampling.Thereafter)
+	}
+
+	checkEnum(ce, "flush.mode", c.Flush.Mode, flushModes)
+	checkEnum(ce, "durability.mode", c.Durability.Mode, durabilities)
+	if c.Durability.Interval < 0 {
+		ce.addf("durability.interval", "negative %v", time.Duration(c.Durability.Interval))
+	}
+	if c.Durability.Level != "" {
+		if _, err := ParseLevel(c.Durability.Level); err != nil {
+			ce.addf("durability.level", "unknown %q, want all, trace, debug, info, warn, error, fatal or a number", c.Durability.Level)
+		}
+	}
+
+	if c.Rotation.MaxSize < 0 {
+		ce.addf("rotation.max_size", "negative %d", c.Rotation.MaxSize)
+	}
+	if c.Rotation.MaxAge < 0 {
+		ce.addf("rotation.max_age", "negative %v", time.Duration(c.Rotation.MaxAge))
+	}
+
+	for i := range c.Sinks {
+		c.Sinks[i].validate(ce, fmt.Sprintf("sinks[%d]", i))
+	}
+
+	if len(ce.Problems) > 0 {
+		return ce
+	}
+
+	return nil
+}
+
+func (sc *SinkConfig) validate(ce *ConfigError, field string) {
+	if _, err := NewEncoder(sc.Encoder); err != nil {
+		ce.addf(field+".encoder", "unknown %q, want text, json or logfmt", sc.Encoder)
+	}
+
+	switch sc.Type {
+	case "net", "syslog":
+		switch sc.Network {
+		case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "unix", "unixgram":
+		case "":
+			if sc.Type == "net" {
+				ce.addf(field+".network", "required, want tcp, udp, unix or unixgram")
+			}
+		default:
+			ce.addf(field+".network", "unknown %q, want tcp, udp, unix or unixgram", sc.Network)
+		}
+
+		if sc.Type == "net" && sc.Addr == "" {
+			ce.addf(field+".addr", "required")
+		}
+		if sc.SpoolSize < 0 {
+			ce.addf(field+".spool_size", "negative %d", sc.SpoolSize)
+		}
+
+		if sc.Type == "net" {
+			checkEnum(ce, field+".framing", sc.Framing, framings)
+		} else {
+			checkEnum(ce, field+".format", sc.Format, syslogFormats)
+			checkEnum(ce, field+".facility", sc.Facility, syslogFacilities)
+		}
+	case "http":
+		if sc.URL == "" {
+			ce.addf(field+".url", "required")
+		} else if u, err := url.Parse(sc.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			ce.addf(field+".url", "%q is not an http or https url", sc.URL)
+		}
+
+		checkEnum(ce, field+".format", sc.Format, httpFormats)
+		if sc.BatchSize < 0 {
+			ce.addf(field+".batch_size", "negative %d", sc.BatchSize)
+		}
+		if sc.BatchWait < 0 {
+			ce.addf(field+".batch_wait", "negative %v", time.Duration(sc.BatchWait))
+		}
+		if sc.MaxRetries < 0 {
+			ce.addf(field+".max_retries", "negative %d", sc.MaxRetries)
+		}
+	case "":
+		ce.addf(field+".type", "required, want net, syslog or http")
+	default:
+		ce.addf(field+".type", "unknown %q, want net, syslog or http", sc.Type)
+	}
+}
+
+// LoggerConfig - validate config and convert it into LoggerConfig, sinks are created
+func (c *Config) LoggerConfig() (*LoggerConfig, error) {
+	return c.loggerConfig(nil, nil)
+}
+
+// loggerConfig - sinks of same config as one in old are taken from oldSinks, which
+// are sinks created of old in order, rather than created again
+func (c *Config) loggerConfig(old *Config, oldSinks []Sink) (*LoggerConfig, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	lc := &LoggerConfig{
+		Prefix:       c.Prefix,
+		Dir:          c.Dir,
+		IsDebug:      c.Debug,
+		SpoolPath:    c.Spool,
+		FlushMode:    consts.FlushModeByDuration,
+		Durability:   durabilities[c.Durability.Mode],
+		SyncInterval: time.Duration(c.Durability.Interval),
+		MaxFileSize:  int64(c.Rotation.MaxSize),
+		MaxAge:       time.Duration(c.Rotation.MaxAge),
+		Metrics:      c.Metrics,
+	}
+
+	if lc.Prefix == "" {
+		lc.Prefix = "KLYN"
+	}
+	if c.Flush.Mode != "" {
+		lc.FlushMode = flushModes[c.Flush.Mode]
+	}
+	if c.Sampling.Initial > 0 || c.Sampling.Thereafter > 0 {
+		lc.Sampling = &Sampling{
+			Tick:       time.Duration(c.Sampling.Tick),
+			Initial:    c.Sampling.Initial,
+			Thereafter: c.Sampling.Thereafter,
+		}
+	}
+
+	// already validated
+	if c.Level != "" {
+		lc.Level, _ = ParseLevel(c.Level)
+	}
+	if c.Durability.Level != "" {
+		lc.SyncLevel, _ = ParseLevel(c.Durability.Level)
+	}
+	lc.Encoder, _ = NewEncoder(c.Encoder)
+
+	var oldConfigs []SinkConfig
+	if old != nil && len(old.Sinks) == len(oldSinks) {
+		oldConfigs = old.Sinks
+	}
+
+	used := make(map[int]bool)
+	for i := range c.Sinks {
+		if j := sameSinkConfig(oldConfigs, used, &c.Sinks[i]); j >= 0 {
+			used[j] = true
+			lc.Sinks = append(lc.Sinks, oldSinks[j])
+			continue
+		}
+
+		sink, err := c.Sinks[i].build()
+		if err != nil {
+			for _, s := range lc.Sinks {
+				if !hasSink(oldSinks, s) {
+					_ = s.Close()
+				}
+			}
+			return nil, fmt.Errorf("klynlog: sinks[%d]: %s", i, strings.TrimPrefix(err.Error(), "klynlog: "))
+		}
+
+		lc.Sinks = append(lc.Sinks, sink)
+	}
+
+	return lc, nil
+}
+
+func (sc *SinkConfig) build() (Sink, error) {
+	enc := Encoder(JSONEncoder{})
+	if sc.Encoder != "" {
+		enc, _ = NewEncoder(sc.Encoder)
+	}
+
+	switch sc.Type {
+	case "net":
+		return NewNetSink(&NetSinkConfig{
+			Network:   sc.Network,
+			Addr:      sc.Addr,
+			Framing:   framings[sc.Framing],
+			Encoder:   enc,
+			SpoolSize: int(sc.SpoolSize),
+		})
+	case "syslog":
+		facility := SyslogUser
+		if sc.Facility != "" {
+			facility = syslogFacilities[sc.Facility]
+		}
+
+		return NewSyslogSink(&SyslogConfig{
+			SyslogEncoder: SyslogEncoder{
+				Format:   syslogFormats[sc.Format],
+				Facility: facility,
+				AppName:  sc.AppName,
+				Hostname: sc.Hostname,
+			},
+			Network: sc.Network,
+			Addr:    sc.Addr,
+			Net:     NetSinkConfig{SpoolSize: int(sc.SpoolSize)},
+		})
+	default:
+		header := make(http.Header)
+		for k, v := range sc.Headers {
+			header.Set(k, v)
+		}
+
+		return NewHTTPSink(&HTTPSinkConfig{
+			URL:             sc.URL,
+			Format:          httpFormats[sc.Format],
+			Encoder:         enc,
+			Header:          header,
+			Gzip:            sc.Gzip,
+			Index:           sc.Index,
+			IndexDateFormat: sc.IndexDateFormat,
+			Labels:          sc.Labels,
+			BatchSize:       sc.BatchSize,
+			BatchWait:       time.Duration(sc.BatchWait),
+			MaxRetries:      sc.MaxRetries,
+			DeadLetter:      sc.DeadLetter,
+		})
+	}
+}
+
+// Build - create logger of config
+func (c *Config) Build() (*KlynLog, error) {
+	lc, err := c.LoggerConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return newLogger(lc, c), nil
+}
+
+// NewLoggerFromFile - load config file with KLYN_* environment variables and create logger of it
+func NewLoggerFromFile(path string) (*KlynLog, error) {
+	c, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Build()
+}
@@ -0,0 +1,252 @@
+package klynlog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+const yamlConfig = `
+prefix: GAME
+dir: /var/log/game
+level: info
+encoder: json
+flush:
+  mode: size
+durability:
+  mode: interval
+  interval: 500ms
+rotation:
+  max_size: 100MB
+  max_age: 168h
+sinks:
+  - type: http
+    url: http://es:9200/_bulk
+    format: elastic_bulk
+    batch_wait: 2s
+    headers:
+      Authorization: Bearer token
+  - type: syslog
+    network: udp
+    addr: 127.0.0.1:514
+    facility: local0
+`
+
+const jsonConfig = `{
+  "prefix": "GAME",
+  "dir": "/var/log/game",
+  "level": "info",
+  "encoder": "json",
+  "flush": {"mode": "size"},
+  "durability": {"mode": "interval", "interval": "500ms"},
+  "rotation": {"max_size": 104857600, "max_age": "168h"},
+  "sinks": [
+    {"type": "http", "url": "http://es:9200/_bulk", "format": "elastic_bulk", "batch_wait": "2s",
+     "headers": {"Authorization": "Bearer token"}},
+    {"type": "syslog", "network": "udp", "addr": "127.0.0.1:514", "facility": "local0"}
+  ]
+}`
+
+const tomlConfig = `
+prefix = "GAME"
+dir = "/var/log/game"
+level = "info"
+encoder = "json"
+
+[flush]
+mode = "size"
+
+[durability]
+mode = "interval"
+interval = "500ms"
+
+[rotation]
+max_size = "100MB"
+max_age = "168h"
+
+[[sinks]]
+type = "http"
+url = "http://es:9200/_bulk"
+format = "elastic_bulk"
+batch_wait = "2s"
+[sinks.headers]
+Authorization = "Bearer token"
+
+[[sinks]]
+type = "syslog"
+network = "udp"
+addr = "127.0.0.1:514"
+facility = "local0"
+`
+
+func TestParseConfigFormats(t *testing.T) {
+	want, err := ParseConfig([]byte(yamlConfig), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want.Rotation.MaxSize != 100<<20 || want.Durability.Interval != Duration(500*time.Millisecond) ||
+		len(want.Sinks) != 2 || want.Sinks[0].Headers["Authorization"] != "Bearer token" {
+		t.Fatalf("unexpected config %+v", want)
+	}
+
+	for format, data := range map[string]string{"json": jsonConfig, "toml": tomlConfig} {
+		c, err := ParseConfig([]byte(data), format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if !reflect.DeepEqual(c, want) {
+			t.Fatalf("%s: want %+v, got %+v", format, want, c)
+		}
+	}
+}
+
+func TestParseConfigUnknownKey(t *testing.T) {
+	for format, data := range map[string]string{
+		"yaml": "prefix: GAME\nlevle: info\n",
+		"json": `{"prefix": "GAME", "levle": "info"}`,
+		"toml": "prefix = \"GAME\"\nlevle = \"info\"\n",
+	} {
+		if _, err := ParseConfig([]byte(data), format); err == nil || !strings.Contains(err.Error(), "levle") {
+			t.Fatalf("%s: want unknown key error, got %v", format, err)
+		}
+	}
+
+	if _, err := ParseConfig(nil, "ini"); err == nil {
+		t.Fatal("want unsupported format error")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	c := &Config{
+		Level:   "verbose",
+		Encoder: "xml",
+		Flush:   FlushConfig{Mode: "sometimes"},
+		Sinks: []SinkConfig{
+			{Type: "net", Network: "tcp"},
+			{Type: "http", URL: "es:9200", Format: "splunk"},
+			{Type: "kafka"},
+		},
+	}
+
+	err := c.Validate()
+	ce, ok := err.(*ConfigError)
+	if !ok {
+		t.Fatalf("want *ConfigError, got %v", err)
+	}
+
+	want := []string{
+		`level: unknown "verbose", want all, trace, debug, info, warn, error, fatal or a number`,
+		`encoder: unknown "xml", want text, json or logfmt`,
+		`flush.mode: unknown "sometimes", want duration, every_log or size`,
+		`sinks[0].addr: required`,
+		`sinks[1].url: "es:9200" is not an http or https url`,
+		`sinks[1].format: unknown "splunk", want elastic_bulk, loki or ndjson`,
+		`sinks[2].type: unknown "kafka", want net, syslog or http`,
+	}
+	if !reflect.DeepEqual(ce.Problems, want) {
+		t.Fatalf("want problems:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(ce.Problems, "\n"))
+	}
+
+	if err = new(Config).Validate(); err != nil {
+		t.Fatalf("want empty config valid, got %v", err)
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "klyn.yaml")
+	if err = ioutil.WriteFile(path, []byte("prefix: GAME\nlevel: info\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range map[string]string{
+		"KLYN_LEVEL":               "warn",
+		"KLYN_DEBUG":               "true",
+		"KLYN_DURABILITY_INTERVAL": "3s",
+		"KLYN_ROTATION_MAX_SIZE":   "1KB",
+	} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Prefix != "GAME" || c.Level != "warn" || !c.Debug ||
+		c.Durability.Interval != Duration(3*time.Second) || c.Rotation.MaxSize != 1024 {
+		t.Fatalf("unexpected config %+v", c)
+	}
+
+	os.Setenv("KLYN_DEBUG", "sometimes")
+	os.Setenv("KLYN_ROTATION_MAX_AGE", "1 week")
+	defer os.Unsetenv("KLYN_ROTATION_MAX_AGE")
+
+	_, err = LoadConfig(path)
+	want := `klynlog: invalid config: KLYN_DEBUG: invalid bool "sometimes"; KLYN_ROTATION_MAX_AGE: invalid duration "1 week"`
+	if err == nil || err.Error() != want {
+		t.Fatalf("want %s, got %v", want, err)
+	}
+}
+
+func TestConfigBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &Config{
+		Prefix:   "GAME",
+		Dir:      dir,
+		Level:    "warn",
+		Encoder:  "json",
+		Flush:    FlushConfig{Mode: "every_log"},
+		Rotation: RotationConfig{MaxSize: 50},
+	}
+
+	logger, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Info("discarded")
+	for i := 0; i < 3; i++ {
+		logger.Warn(map[string]interface{}{"userId": i})
+	}
+	if err = logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Now().Format(consts.LogFileDateFormat)
+	var lines []string
+	for _, name := range []string{"GAME-" + day + ".1.log", "GAME-" + day + ".2.log", "GAME-" + day + ".log"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSpace(string(b)))
+	}
+
+	for i, line := range lines {
+		if !strings.HasPrefix(line, `{"prefix":"GAME","time":"`) ||
+			!strings.HasSuffix(line, `"level":"warn","message":{"userId":`+strconv.Itoa(i)+`}}`) {
+			t.Fatalf("unexpected line %s", line)
+		}
+	}
+}
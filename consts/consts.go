@@ -19,6 +19,10 @@ const (
 const (
 	// DefaultLogDir -
 	DefaultLogDir = "logFiles"
+	// LogFileDateFormat - date part of log file name, one file per prefix per day
+	LogFileDateFormat = "2006-01-02"
+	// LogTimeFormat - time of each log line
+	LogTimeFormat = "2006-01-02T15:04:05.000Z07:00"
 )
 
 const (
@@ -29,3 +33,26 @@ const (
 	// FlushModeBySize - flush cache to disk only when cache larger then size setted
 	FlushModeBySize
 )
+
+const (
+	// DurabilityNone - never fsync log file, left to os
+	DurabilityNone = iota
+	// DurabilityEveryFlush - fsync log file after every flush of cache, or every log in FlushModeEveryLog
+	DurabilityEveryFlush
+	// DurabilityInterval - fsync log file every sync interval if written since last fsync
+	DurabilityInterval
+	// DurabilityLevel - flush cache and fsync log file once a record at or above sync level is logged
+	DurabilityLevel
+)
+
+const (
+	// DefaultSyncInterval - fsync interval of DurabilityInterval
+	DefaultSyncInterval = time.Second
+)
+
+const (
+	// DefaultSamplingTick - period records are counted in by sampling
+	DefaultSamplingTick = time.Second
+	// DefaultWatchInterval - how often watched config file is checked for change
+	DefaultWatchInterval = 2 * time.Second
+)
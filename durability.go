@@ -0,0 +1,82 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+// SyncStats - fsync calls on log file and their latency
+type SyncStats struct {
+	Count  uint64        `json:"count"`  // fsync calls
+	Errors uint64        `json:"errors"` // fsync calls failed
+	Total  time.Duration `json:"total"`  // total latency, Total / Count is average
+	Max    time.Duration `json:"max"`
+	Last   time.Duration `json:"last"`
+}
+
+type syncStats struct {
+	lock  sync.Mutex
+	stats SyncStats
+}
+
+func (ss *syncStats) record(d time.Duration, err error) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	ss.stats.Count++
+	if err != nil {
+		ss.stats.Errors++
+	}
+
+	ss.stats.Total += d
+	ss.stats.Last = d
+	if d > ss.stats.Max {
+		ss.stats.Max = d
+	}
+}
+
+func (ss *syncStats) get() SyncStats {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	return ss.stats
+}
+
+// SyncStats - fsync stats of log file since logger created
+func (kl *KlynLog) SyncStats() SyncStats {
+	return kl.logWriter.stats.get()
+}
+
+// syncLevel - records at or above it are fsynced in DurabilityLevel, LoggerLevelError if not set
+func (kl *KlynLog) syncLevel() Level {
+	if l := kl.conf().SyncLevel; l != 0 {
+		return l
+	}
+
+	return LoggerLevelError
+}
+
+// syncOnLevel - whether record of level is fsynced as soon as logged
+func (kl *KlynLog) syncOnLevel(l Level) bool {
+	return kl.conf().Durability == consts.DurabilityLevel && l >= kl.syncLevel()
+}
+
+// syncOnFlush - whether every write of cache is fsynced
+func (kl *KlynLog) syncOnFlush() bool {
+	return kl.conf().Durability == consts.DurabilityEveryFlush
+}
+
+// syncIntervalOf - fsync interval of DurabilityInterval, consts.DefaultSyncInterval if not set
+func syncIntervalOf(c *LoggerConfig) time.Duration {
+	if c.SyncInterval <= 0 {
+		return consts.DefaultSyncInterval
+	}
+
+	return c.SyncInterval
+}
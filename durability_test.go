@@ -0,0 +1,108 @@
+package klynlog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+func newDurabilityLogger(conf *LoggerConfig) (*KlynLog, string) {
+	conf.Prefix = fmt.Sprintf("durability%d", time.Now().UnixNano())
+	fileName := fmt.Sprintf("%s/%s-%s.log", consts.DefaultLogDir, conf.Prefix, time.Now().Format(consts.LogFileDateFormat))
+
+	return NewLogger(conf).(*KlynLog), fileName
+}
+
+func TestDurabilityNone(t *testing.T) {
+	logger, fileName := newDurabilityLogger(&LoggerConfig{FlushMode: consts.FlushModeEveryLog})
+	defer os.Remove(fileName)
+
+	logger.Error("not synced")
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := logger.SyncStats(); stats.Count != 0 {
+		t.Fatalf("want no fsync, got %+v", stats)
+	}
+}
+
+func TestDurabilityEveryFlush(t *testing.T) {
+	logger, fileName := newDurabilityLogger(&LoggerConfig{
+		FlushMode:  consts.FlushModeByDuration,
+		Durability: consts.DurabilityEveryFlush,
+	})
+	defer os.Remove(fileName)
+
+	logger.Info("first")
+	if err := logger.syncAndFlushCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := logger.SyncStats()
+	if stats.Count == 0 || stats.Errors != 0 || stats.Max < stats.Last || stats.Total < stats.Max {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDurabilityLevel(t *testing.T) {
+	logger, fileName := newDurabilityLogger(&LoggerConfig{
+		FlushMode:  consts.FlushModeBySize,
+		Durability: consts.DurabilityLevel,
+	})
+	defer os.Remove(fileName)
+
+	logger.Info("cached")
+	if stats := logger.SyncStats(); stats.Count != 0 {
+		t.Fatalf("want no fsync below sync level, got %+v", stats)
+	}
+
+	// error flushes what is cached before it
+	logger.Error("synced")
+	if stats := logger.SyncStats(); stats.Count != 1 {
+		t.Fatalf("want 1 fsync, got %+v", stats)
+	}
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `message:"cached"`) || !strings.Contains(string(b), `message:"synced"`) {
+		t.Fatalf("want both records in file, got:\n%s", b)
+	}
+
+	if err = logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDurabilityInterval(t *testing.T) {
+	logger, fileName := newDurabilityLogger(&LoggerConfig{
+		FlushMode:    consts.FlushModeEveryLog,
+		Durability:   consts.DurabilityInterval,
+		SyncInterval: 10 * time.Millisecond,
+	})
+	defer os.Remove(fileName)
+
+	logger.Warn("synced later")
+	time.Sleep(100 * time.Millisecond)
+
+	// nothing written since, no more fsync
+	count := logger.SyncStats().Count
+	if count != 1 {
+		t.Fatalf("want 1 fsync, got %d", count)
+	}
+
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
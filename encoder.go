@@ -0,0 +1,201 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+// Encoder - encode entry into a newline terminated line
+type Encoder interface {
+	Encode(e *Entry) ([]byte, error)
+}
+
+// EncoderFunc - func as Encoder
+type EncoderFunc func(e *Entry) ([]byte, error)
+
+// Encode - call f
+func (f EncoderFunc) Encode(e *Entry) ([]byte, error) {
+	return f(e)
+}
+
+// TextEncoder - default format of log files:
+// [PREFIX] | TIME:2006-01-02T15:04:05.000Z07:00 | LEVEL:warn | message:{...}
+type TextEncoder struct{}
+
+// Encode - implement Encoder
+func (TextEncoder) Encode(e *Entry) ([]byte, error) {
+	b, err := json.Marshal(e.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	line := fmt.Sprintf("[%s] | TIME:%s | LEVEL:%s | message:%s\n",
+		e.Prefix, e.Time.Format(consts.LogTimeFormat), e.Level.String(), string(b))
+	return []byte(line), nil
+}
+
+// JSONEncoder - one json object per line:
+// {"prefix":"PREFIX","time":"2006-01-02T15:04:05.000Z07:00","level":"warn","message":{...}}
+type JSONEncoder struct{}
+
+type jsonLine struct {
+	Prefix  string      `json:"prefix"`
+	Time    string      `json:"time"`
+	Level   string      `json:"level"`
+	Message interface{} `json:"message"`
+}
+
+// Encode - implement Encoder
+func (JSONEncoder) Encode(e *Entry) ([]byte, error) {
+	b, err := json.Marshal(jsonLine{
+		Prefix:  e.Prefix,
+		Time:    e.Time.Format(consts.LogTimeFormat),
+		Level:   e.Level.String(),
+		Message: e.Data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+// LogfmtEncoder - key=value pairs per line:
+// prefix=PREFIX time=2006-01-02T15:04:05.000Z07:00 level=warn userId=1 event.gameId=dddjs
+// nested objects are flattened into dotted keys, payload which is not an object is written as message=...
+// arrays are written as json, so arrays of strings are read back as string.
+type LogfmtEncoder struct{}
+
+// Encode - implement Encoder
+func (LogfmtEncoder) Encode(e *Entry) ([]byte, error) {
+	// round trip through json so structs are encoded by their json tags
+	data, err := jsonValue(e.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	writeLogfmtPair(buf, "prefix", e.Prefix)
+	writeLogfmtPair(buf, "time", e.Time.Format(consts.LogTimeFormat))
+	writeLogfmtPair(buf, "level", e.Level.String())
+
+	if m, ok := data.(map[string]interface{}); ok {
+		flattenLogfmt(buf, "", m)
+	} else {
+		writeLogfmtValue(buf, "message", data)
+	}
+
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func flattenLogfmt(buf *bytes.Buffer, prefix string, m map[string]interface{}) {
+	walkFields(prefix, m, func(key string, v interface{}) {
+		if s, ok := v.(string); ok {
+			// quote strings like "123" or "null" so they are not read back as number or null,
+			// jsoniter Valid rejects bare numbers so encoding/json is used
+			writeLogfmtString(buf, key, s, stdjson.Valid([]byte(s)))
+			return
+		}
+
+		writeLogfmtPair(buf, key, fieldString(v))
+	})
+}
+
+func writeLogfmtValue(buf *bytes.Buffer, key string, v interface{}) {
+	flattenLogfmt(buf, "", map[string]interface{}{key: v})
+}
+
+// walkFields - call fn with dotted key of every field which is not a non-empty object, in key order
+func walkFields(prefix string, m map[string]interface{}, fn func(key string, v interface{})) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if sub, ok := m[k].(map[string]interface{}); ok && len(sub) > 0 {
+			walkFields(prefix+k+".", sub, fn)
+			continue
+		}
+
+		fn(prefix+k, m[k])
+	}
+}
+
+// fieldString - printed form of json decoded value
+func fieldString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(val)
+	case fmt.Stringer:
+		// json.Number
+		return val.String()
+	default:
+		// arrays and empty objects stay json
+		b, _ := json.Marshal(val)
+		return string(b)
+	}
+}
+
+func writeLogfmtPair(buf *bytes.Buffer, key, val string) {
+	writeLogfmtString(buf, key, val, false)
+}
+
+func writeLogfmtString(buf *bytes.Buffer, key, val string, quote bool) {
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	if quote || needQuote(val) {
+		buf.WriteString(strconv.Quote(val))
+	} else {
+		buf.WriteString(val)
+	}
+}
+
+func needQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewEncoder - get encoder by name: text, json or logfmt
+func NewEncoder(name string) (Encoder, error) {
+	switch strings.ToLower(name) {
+	case "", "text":
+		return TextEncoder{}, nil
+	case "json":
+		return JSONEncoder{}, nil
+	case "logfmt":
+		return LogfmtEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("klynlog: unknown encoder %q", name)
+	}
+}
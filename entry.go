@@ -0,0 +1,88 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"bytes"
+	"time"
+)
+
+// Entry - a single log record
+type Entry struct {
+	Prefix string
+	Time   time.Time
+	Level  Level
+	Data   interface{} // payload passed to Logger
+}
+
+// Clone - copy of e, payload object is copied so fields can be changed separately
+func (e *Entry) Clone() *Entry {
+	c := *e
+	if m, ok := e.Data.(map[string]interface{}); ok {
+		c.Data = copyFields(m)
+	}
+
+	return &c
+}
+
+// WithFields - add fields to payload.
+// map payload is copied before changed, other payloads are converted to object through json,
+// payload which is not an object is kept under key "message".
+func (e *Entry) WithFields(fields map[string]interface{}) *Entry {
+	var m map[string]interface{}
+	switch data := e.Data.(type) {
+	case map[string]interface{}:
+		m = copyFields(data)
+	default:
+		m = toFields(data)
+	}
+
+	for k, v := range fields {
+		m[k] = v
+	}
+
+	e.Data = m
+	return e
+}
+
+func copyFields(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
+
+func toFields(data interface{}) map[string]interface{} {
+	v, _ := jsonValue(data)
+	if m, ok := v.(map[string]interface{}); ok {
+		return m
+	}
+
+	m := make(map[string]interface{})
+	if data != nil {
+		m["message"] = v
+	}
+
+	return m
+}
+
+// jsonValue - json decoded copy of v, numbers are kept as json.Number
+func jsonValue(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var val interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err = dec.Decode(&val); err != nil {
+		return nil, err
+	}
+
+	return val, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"log"
+	"os"
+)
+
+// Hook - intercept entries after redaction and before they are encoded into cache
+type Hook interface {
+	// Levels - levels hook fires on, nil means all levels
+	Levels() []Level
+	// Fire - return entries logging goes on with: nil to drop e,
+	// e itself to keep it or more entries to duplicate it.
+	// e is kept as is when error returned.
+	Fire(e *Entry) ([]*Entry, error)
+}
+
+// HookFunc - func as Hook fires on all levels
+type HookFunc func(e *Entry) ([]*Entry, error)
+
+// Levels - implement Hook
+func (f HookFunc) Levels() []Level {
+	return nil
+}
+
+// Fire - call f
+func (f HookFunc) Fire(e *Entry) ([]*Entry, error) {
+	return f(e)
+}
+
+type levelHook struct {
+	levels []Level
+	fire   HookFunc
+}
+
+// LevelHook - hook calls fire only on levels, like alerting on error
+func LevelHook(fire HookFunc, levels ...Level) Hook {
+	return &levelHook{levels: levels, fire: fire}
+}
+
+func (h *levelHook) Levels() []Level {
+	return h.levels
+}
+
+func (h *levelHook) Fire(e *Entry) ([]*Entry, error) {
+	return h.fire(e)
+}
+
+// FieldsHook - add fields to every entry, like build version
+func FieldsHook(fields map[string]interface{}, levels ...Level) Hook {
+	return LevelHook(func(e *Entry) ([]*Entry, error) {
+		e.WithFields(fields)
+		return []*Entry{e}, nil
+	}, levels...)
+}
+
+// HostHook - add hostname and, when running in kubernetes, pod name from POD_NAME env
+func HostHook() Hook {
+	fields := make(map[string]interface{})
+	if hostname, err := os.Hostname(); err == nil {
+		fields["hostname"] = hostname
+	}
+
+	if pod := os.Getenv("POD_NAME"); pod != "" {
+		fields["pod"] = pod
+	}
+
+	return FieldsHook(fields)
+}
+
+// fireHooks - run entry through hooks in order, entries duplicated by a hook go through following hooks
+func fireHooks(hooks []Hook, e *Entry) []*Entry {
+	entries := []*Entry{e}
+	for _, h := range hooks {
+		next := make([]*Entry, 0, len(entries))
+		for _, e := range entries {
+			if !hookFiresOn(h, e.Level) {
+				next = append(next, e)
+				continue
+			}
+
+			fired, err := h.Fire(e)
+			if err != nil {
+				log.Printf("klynlog: hook fire failed:%v", err)
+				next = append(next, e)
+				continue
+			}
+
+			for _, f := range fired {
+				if f != nil {
+					next = append(next, f)
+				}
+			}
+		}
+
+		entries = next
+	}
+
+	return entries
+}
+
+func hookFiresOn(h Hook, l Level) bool {
+	levels := h.Levels()
+	if levels == nil {
+		return true
+	}
+
+	for _, v := range levels {
+		if v == l {
+			return true
+		}
+	}
+
+	return false
+}
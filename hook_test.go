@@ -0,0 +1,109 @@
+package klynlog
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+func TestFireHooks(t *testing.T) {
+	var order []string
+	trace := func(name string) Hook {
+		return HookFunc(func(e *Entry) ([]*Entry, error) {
+			order = append(order, fmt.Sprintf("%s:%v", name, e.Data.(map[string]interface{})["copy"]))
+			return []*Entry{e}, nil
+		})
+	}
+
+	hooks := []Hook{
+		FieldsHook(map[string]interface{}{"version": "v1.0.0"}),
+		// duplicate error entries, like sending one copy elsewhere
+		LevelHook(func(e *Entry) ([]*Entry, error) {
+			return []*Entry{e, e.Clone().WithFields(map[string]interface{}{"copy": true})}, nil
+		}, LoggerLevelError),
+		trace("trace"),
+		// drop debug entries
+		LevelHook(func(e *Entry) ([]*Entry, error) {
+			return nil, nil
+		}, LoggerLevelDebug),
+		// failed hook keeps entry as is
+		HookFunc(func(e *Entry) ([]*Entry, error) {
+			e.WithFields(map[string]interface{}{"broken": true})
+			return nil, errors.New("broken")
+		}),
+	}
+
+	payload := map[string]interface{}{"userId": 1}
+	entries := fireHooks(hooks, &Entry{Level: LoggerLevelError, Data: payload})
+	if len(entries) != 2 {
+		t.Fatalf("want 2 entries, got %d", len(entries))
+	}
+
+	for i, e := range entries {
+		m := e.Data.(map[string]interface{})
+		if m["version"] != "v1.0.0" || m["userId"] != 1 || m["broken"] != true || (m["copy"] == true) != (i == 1) {
+			t.Fatalf("unexpected entry %d: %v", i, m)
+		}
+	}
+
+	if strings.Join(order, ",") != "trace:<nil>,trace:true" {
+		t.Fatalf("unexpected order %v", order)
+	}
+
+	if len(payload) != 1 {
+		t.Fatalf("payload modified: %v", payload)
+	}
+
+	if entries = fireHooks(hooks, &Entry{Level: LoggerLevelDebug, Data: "plain"}); len(entries) != 0 {
+		t.Fatalf("want debug dropped, got %v", entries)
+	}
+}
+
+func TestAddHook(t *testing.T) {
+	prefix := fmt.Sprintf("hook%d", time.Now().UnixNano())
+	logger := NewLogger(&LoggerConfig{
+		Prefix:    prefix,
+		FlushMode: consts.FlushModeEveryLog,
+		Hooks:     []Hook{FieldsHook(map[string]interface{}{"pod": "pod-1"})},
+	}).(*KlynLog)
+
+	fileName := fmt.Sprintf("%s/%s-%s.log", consts.DefaultLogDir, prefix, time.Now().Format(consts.LogFileDateFormat))
+	defer os.Remove(fileName)
+
+	var (
+		alerts []*Entry
+		lock   sync.Mutex
+	)
+	logger.AddHook(LevelHook(func(e *Entry) ([]*Entry, error) {
+		lock.Lock()
+		alerts = append(alerts, e.Clone())
+		lock.Unlock()
+		return []*Entry{e}, nil
+	}, LoggerLevelError, LoggerLevelFatal))
+
+	logger.Info(map[string]interface{}{"userId": 1})
+	logger.Error("plain message")
+
+	if len(alerts) != 1 || alerts[0].Data.(map[string]interface{})["message"] != "plain message" {
+		t.Fatalf("unexpected alerts %v", alerts)
+	}
+
+	written, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(written)), "\n")
+	if len(lines) != 2 ||
+		!strings.HasSuffix(lines[0], `message:{"pod":"pod-1","userId":1}`) ||
+		!strings.HasSuffix(lines[1], `message:{"message":"plain message","pod":"pod-1"}`) {
+		t.Fatalf("unexpected file:\n%s", written)
+	}
+}
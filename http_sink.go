@@ -0,0 +1,581 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// HTTPFormat - body format of batch posted by HTTPSink
+type HTTPFormat int
+
+const (
+	// HTTPFormatNDJSON - one encoded record per line
+	HTTPFormatNDJSON HTTPFormat = iota
+	// HTTPFormatElasticBulk - elasticsearch _bulk api, index action line before every record
+	HTTPFormatElasticBulk
+	// HTTPFormatLoki - loki push api json, streams labeled by prefix and level
+	HTTPFormatLoki
+)
+
+const (
+	defaultHTTPTimeout    = 10 * time.Second
+	defaultHTTPBatchSize  = 500
+	defaultHTTPBatchBytes = 1 << 20 // 1M
+	defaultHTTPBatchWait  = time.Second
+	defaultHTTPQueueSize  = 10000
+	defaultHTTPRetries    = 3
+	defaultHTTPIndex      = "klynlog"
+)
+
+// HTTPSinkConfig - http sink config
+type HTTPSinkConfig struct {
+	URL     string
+	Format  HTTPFormat
+	Encoder Encoder     // JSONEncoder if nil, encoded record is document of bulk and line of loki
+	Header  http.Header // added to every request, like Authorization
+	Client  *http.Client
+	Gzip    bool // compress request body
+
+	Index           string            // elasticsearch index, lowercase prefix of entry if empty
+	IndexDateFormat string            // index is suffixed with "-" and time of entry in this format if set, like "2006.01.02"
+	Labels          map[string]string // loki stream labels in addition to prefix and level
+
+	BatchSize  int           // max records of a request, 500 if zero
+	BatchBytes int           // max encoded bytes of a request before compressed, 1M if zero
+	BatchWait  time.Duration // max time a record waits for batch to fill, 1s if zero
+	QueueSize  int           // max records held in memory, new records are dropped when full. 10000 if zero
+
+	MaxRetries int           // retries of a failed request, 3 if zero
+	MinBackoff time.Duration // first retry delay, doubled every retry. 100ms if zero
+	MaxBackoff time.Duration // 30s if zero
+
+	// DeadLetter - file batches are appended to, one record per line, when endpoint
+	// still fails after retries or rejects them, only failed items of elasticsearch bulk.
+	// batches are dropped if empty.
+	DeadLetter   string
+	CloseTimeout time.Duration // max time Close waits for queue to be sent, 5s if zero
+}
+
+// HTTPSink - batch records and post them to a log collector over http.
+// a batch is posted when it is full or its first record waited BatchWait.
+type HTTPSink struct {
+	conf *HTTPSinkConfig
+
+	lock   sync.Mutex
+	queue  []*httpRecord
+	closed bool
+	notify chan struct{}
+
+	dropped      uint64
+	deadLettered uint64
+	meter        sinkMeter
+
+	ctx    context.Context
+	cancel context.CancelFunc // called when close timeout reached
+	done   chan struct{}
+}
+
+type httpRecord struct {
+	at     time.Time // time queued
+	time   time.Time
+	prefix string
+	level  Level
+	index  string
+	line   []byte // without trailing '\n'
+}
+
+// NewHTTPSink - get http sink and start posting in background
+func NewHTTPSink(conf *HTTPSinkConfig) (*HTTPSink, error) {
+	c := *conf
+	if c.URL == "" {
+		return nil, errors.New("klynlog: http sink url is empty")
+	}
+
+	switch c.Format {
+	case HTTPFormatNDJSON, HTTPFormatElasticBulk, HTTPFormatLoki:
+	default:
+		return nil, fmt.Errorf("klynlog: unsupported http format %d", c.Format)
+	}
+
+	if c.Encoder == nil {
+		c.Encoder = JSONEncoder{}
+	}
+
+	if c.Client == nil {
+		c.Client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+
+	setDefaultInt(&c.BatchSize, defaultHTTPBatchSize)
+	setDefaultInt(&c.BatchBytes, defaultHTTPBatchBytes)
+	setDefaultDuration(&c.BatchWait, defaultHTTPBatchWait)
+	setDefaultInt(&c.QueueSize, defaultHTTPQueueSize)
+	setDefaultInt(&c.MaxRetries, defaultHTTPRetries)
+	setDefaultDuration(&c.MinBackoff, defaultNetMinBackoff)
+	setDefaultDuration(&c.MaxBackoff, defaultNetMaxBackoff)
+	setDefaultDuration(&c.CloseTimeout, defaultNetCloseTimeout)
+
+	hs := &HTTPSink{
+		conf:   &c,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	hs.ctx, hs.cancel = context.WithCancel(context.Background())
+
+	go hs.run()
+	return hs, nil
+}
+
+// Write - implement Sink, encode entries into queue
+func (hs *HTTPSink) Write(entries []*Entry) error {
+	now := time.Now()
+	records := make([]*httpRecord, 0, len(entries))
+	for _, e := range entries {
+		line, err := hs.conf.Encoder.Encode(e)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, &httpRecord{
+			at:     now,
+			time:   e.Time,
+			prefix: e.Prefix,
+			level:  e.Level,
+			index:  hs.index(e),
+			line:   bytes.TrimSuffix(line, []byte("\n")),
+		})
+	}
+
+	hs.lock.Lock()
+	if hs.closed {
+		hs.lock.Unlock()
+		return errors.New("klynlog: http sink closed")
+	}
+
+	for _, r := range records {
+		if len(hs.queue) >= hs.conf.QueueSize {
+			atomic.AddUint64(&hs.dropped, 1)
+			continue
+		}
+
+		hs.queue = append(hs.queue, r)
+	}
+	hs.lock.Unlock()
+
+	hs.wake()
+	return nil
+}
+
+// Dropped - number of records dropped as queue was full, or failed without dead letter file
+func (hs *HTTPSink) Dropped() uint64 {
+	return atomic.LoadUint64(&hs.dropped)
+}
+
+// DeadLettered - number of records written to dead letter file
+func (hs *HTTPSink) DeadLettered() uint64 {
+	return atomic.LoadUint64(&hs.deadLettered)
+}
+
+// instrument - target of metrics is host of url, which never carries credentials of it
+func (hs *HTTPSink) instrument(m Metrics, prefix string) {
+	target := hs.conf.URL
+	if u, err := url.Parse(hs.conf.URL); err == nil {
+		target = u.Host
+	}
+
+	hs.meter.set(m, "prefix", prefix, "sink", "http", "target", target)
+}
+
+// Close - implement Sink, post queued records until CloseTimeout,
+// what is left then goes to dead letter file
+func (hs *HTTPSink) Close() error {
+	hs.lock.Lock()
+	if hs.closed {
+		hs.lock.Unlock()
+		return nil
+	}
+	hs.closed = true
+	hs.lock.Unlock()
+	hs.wake()
+
+	var err error
+	select {
+	case <-hs.done:
+	case <-time.After(hs.conf.CloseTimeout):
+		err = errors.New("klynlog: http sink closed before queue was sent")
+		hs.cancel()
+		<-hs.done
+	}
+	hs.cancel()
+
+	return err
+}
+
+func (hs *HTTPSink) wake() {
+	select {
+	case hs.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (hs *HTTPSink) index(e *Entry) string {
+	if hs.conf.Format != HTTPFormatElasticBulk {
+		return ""
+	}
+
+	index := hs.conf.Index
+	if index == "" {
+		index = strings.ToLower(e.Prefix)
+	}
+	if index == "" {
+		index = defaultHTTPIndex
+	}
+
+	if hs.conf.IndexDateFormat != "" {
+		index += "-" + e.Time.Format(hs.conf.IndexDateFormat)
+	}
+
+	return index
+}
+
+func (hs *HTTPSink) run() {
+	defer close(hs.done)
+
+	for {
+		batch, ok := hs.next()
+		if !ok {
+			return
+		}
+
+		hs.deliver(batch)
+	}
+}
+
+// next - wait for a batch to be full or its first record to wait long enough,
+// false if closed and queue is empty
+func (hs *HTTPSink) next() ([]*httpRecord, bool) {
+	for {
+		var timer *time.Timer
+		hs.lock.Lock()
+		if len(hs.queue) == 0 && hs.closed {
+			hs.lock.Unlock()
+			return nil, false
+		}
+
+		if len(hs.queue) > 0 {
+			n := hs.batchLen()
+			wait := hs.conf.BatchWait - time.Since(hs.queue[0].at)
+			if n < len(hs.queue) || n == hs.conf.BatchSize || hs.closed || wait <= 0 {
+				batch := make([]*httpRecord, n)
+				copy(batch, hs.queue)
+				for i := 0; i < n; i++ {
+					hs.queue[i] = nil
+				}
+				hs.queue = hs.queue[n:]
+				hs.lock.Unlock()
+				return batch, true
+			}
+
+			timer = time.NewTimer(wait)
+		}
+		hs.lock.Unlock()
+
+		if timer == nil {
+			<-hs.notify
+			continue
+		}
+
+		select {
+		case <-hs.notify:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// batchLen - records at head of queue fit in a batch, at least one
+func (hs *HTTPSink) batchLen() int {
+	var n, size int
+	for _, r := range hs.queue {
+		if n == hs.conf.BatchSize || (n > 0 && size+len(r.line) > hs.conf.BatchBytes) {
+			break
+		}
+
+		size += len(r.line)
+		n++
+	}
+
+	return n
+}
+
+// deliver - post batch with retry, dead letter it when still failed
+func (hs *HTTPSink) deliver(batch []*httpRecord) {
+	body, err := hs.body(batch)
+	if err == nil {
+		backoff := hs.conf.MinBackoff
+		for i := 0; ; i++ {
+			var retry bool
+			if retry, err = hs.post(body); err == nil {
+				hs.meter.written(len(body))
+				return
+			}
+			hs.meter.failed()
+
+			if !retry || i >= hs.conf.MaxRetries {
+				break
+			}
+
+			select {
+			case <-hs.ctx.Done():
+			case <-time.After(backoff):
+			}
+
+			if backoff *= 2; backoff > hs.conf.MaxBackoff {
+				backoff = hs.conf.MaxBackoff
+			}
+		}
+	}
+
+	log.Printf("klynlog: http sink failed to post %d records:%v", len(batch), err)
+	if berr, ok := err.(*bulkError); ok {
+		// items indexed are not sent again
+		batch = berr.records(batch)
+	}
+	hs.deadLetter(batch)
+}
+
+func (hs *HTTPSink) body(batch []*httpRecord) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	switch hs.conf.Format {
+	case HTTPFormatNDJSON:
+		for _, r := range batch {
+			buf.Write(r.line)
+			buf.WriteByte('\n')
+		}
+	case HTTPFormatElasticBulk:
+		for _, r := range batch {
+			action, err := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": r.index}})
+			if err != nil {
+				return nil, err
+			}
+
+			buf.Write(action)
+			buf.WriteByte('\n')
+			buf.Write(r.line)
+			buf.WriteByte('\n')
+		}
+	case HTTPFormatLoki:
+		b, err := hs.lokiBody(batch)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+
+	if !hs.conf.Gzip {
+		return buf.Bytes(), nil
+	}
+
+	zbuf := new(bytes.Buffer)
+	zw := gzip.NewWriter(zbuf)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return zbuf.Bytes(), nil
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiBody - one stream per prefix and level, in order of first record
+func (hs *HTTPSink) lokiBody(batch []*httpRecord) ([]byte, error) {
+	var streams []*lokiStream
+	byKey := make(map[string]*lokiStream)
+	for _, r := range batch {
+		key := r.prefix + "\x00" + r.level.String()
+		s, ok := byKey[key]
+		if !ok {
+			s = &lokiStream{Stream: make(map[string]string, len(hs.conf.Labels)+2)}
+			for k, v := range hs.conf.Labels {
+				s.Stream[k] = v
+			}
+			s.Stream["prefix"] = r.prefix
+			s.Stream["level"] = r.level.String()
+
+			byKey[key] = s
+			streams = append(streams, s)
+		}
+
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(r.time.UnixNano(), 10), string(r.line)})
+	}
+
+	return json.Marshal(map[string]interface{}{"streams": streams})
+}
+
+// post - send body once, retry is true when failure may be temporary
+func (hs *HTTPSink) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, hs.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(hs.ctx)
+
+	for k, vs := range hs.conf.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+
+	if hs.conf.Format == HTTPFormatLoki {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	if hs.conf.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := hs.conf.Client.Do(req)
+	if err != nil {
+		return hs.ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// body is only read for error message
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		err = fmt.Errorf("http status %d: %s", resp.StatusCode, respBody)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return hs.ctx.Err() == nil, err
+		}
+		return false, err
+	}
+
+	if hs.conf.Format == HTTPFormatElasticBulk {
+		return false, readBulkResponse(resp.Body)
+	}
+
+	return false, nil
+}
+
+// bulkError - items of bulk request failed, by position in batch. all failed if failed is nil
+type bulkError struct {
+	failed []int
+	total  int
+}
+
+func (e *bulkError) Error() string {
+	if e.failed == nil {
+		return "bulk request has failed items"
+	}
+	return fmt.Sprintf("bulk request has %d of %d items failed", len(e.failed), e.total)
+}
+
+// records - records of batch failed
+func (e *bulkError) records(batch []*httpRecord) []*httpRecord {
+	if e.failed == nil || e.total != len(batch) {
+		return batch
+	}
+
+	failed := make([]*httpRecord, 0, len(e.failed))
+	for _, i := range e.failed {
+		failed = append(failed, batch[i])
+	}
+	return failed
+}
+
+// bulkItem - result of one action, keyed by action name like index
+type bulkItem map[string]struct {
+	Status int                 `json:"status"`
+	Error  jsoniter.RawMessage `json:"error"`
+}
+
+// readBulkResponse - errors and items of bulk response, other fields are skipped.
+// body can not be parsed is taken as failed
+func readBulkResponse(r io.Reader) error {
+	var result struct {
+		Errors bool       `json:"errors"`
+		Items  []bulkItem `json:"items"`
+	}
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return fmt.Errorf("invalid bulk response: %v", err)
+	}
+
+	if !result.Errors {
+		return nil
+	}
+
+	berr := &bulkError{total: len(result.Items)}
+	for i, item := range result.Items {
+		for _, res := range item {
+			if res.Status >= 300 || (len(res.Error) > 0 && string(res.Error) != "null") {
+				berr.failed = append(berr.failed, i)
+				break
+			}
+		}
+	}
+	if len(berr.failed) == 0 {
+		// errors without failed item, not known which ones
+		berr.failed = nil
+	}
+
+	return berr
+}
+
+func (hs *HTTPSink) deadLetter(batch []*httpRecord) {
+	if hs.conf.DeadLetter == "" {
+		atomic.AddUint64(&hs.dropped, uint64(len(batch)))
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	for _, r := range batch {
+		buf.Write(r.line)
+		buf.WriteByte('\n')
+	}
+
+	err := os.MkdirAll(filepath.Dir(hs.conf.DeadLetter), os.ModePerm)
+	if err == nil {
+		var file *os.File
+		if file, err = os.OpenFile(hs.conf.DeadLetter, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666); err == nil {
+			_, err = file.Write(buf.Bytes())
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+
+	if err != nil {
+		log.Printf("klynlog: http sink failed to write dead letter file:%v", err)
+		atomic.AddUint64(&hs.dropped, uint64(len(batch)))
+		return
+	}
+
+	atomic.AddUint64(&hs.deadLettered, uint64(len(batch)))
+}
@@ -0,0 +1,380 @@
+package klynlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector - httptest handler recording bodies, status of nth request is statuses[n] or 200
+type collector struct {
+	lock     sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+	received chan struct{}
+}
+
+func newCollector(statuses ...int) *collector {
+	return &collector{statuses: statuses, received: make(chan struct{}, 100)}
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	b, _ := ioutil.ReadAll(body)
+
+	c.lock.Lock()
+	status := http.StatusOK
+	if n := len(c.requests); n < len(c.statuses) {
+		status = c.statuses[n]
+	}
+	c.requests = append(c.requests, r)
+	c.bodies = append(c.bodies, string(b))
+	c.lock.Unlock()
+
+	w.WriteHeader(status)
+	if status == http.StatusOK && strings.HasSuffix(r.URL.Path, "_bulk") {
+		_, _ = w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+	}
+	c.received <- struct{}{}
+}
+
+func (c *collector) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-c.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting request %d", i)
+		}
+	}
+}
+
+func (c *collector) snapshot() ([]*http.Request, []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*http.Request(nil), c.requests...), append([]string(nil), c.bodies...)
+}
+
+func TestHTTPSinkNDJSONBatches(t *testing.T) {
+	c := newCollector()
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	sink, err := NewHTTPSink(&HTTPSinkConfig{
+		URL:       srv.URL,
+		Gzip:      true,
+		Header:    http.Header{"Authorization": []string{"Bearer token"}},
+		BatchSize: 2,
+		BatchWait: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = sink.Write(testEntries(0, 3)); err != nil {
+		t.Fatal(err)
+	}
+
+	// full batch goes at once, the rest after BatchWait
+	c.wait(t, 2)
+	reqs, bodies := c.snapshot()
+	if want := wantLine(0) + "\n" + wantLine(1) + "\n"; bodies[0] != want {
+		t.Fatalf("want %s, got %s", want, bodies[0])
+	}
+	if want := wantLine(2) + "\n"; bodies[1] != want {
+		t.Fatalf("want %s, got %s", want, bodies[1])
+	}
+
+	r := reqs[0]
+	if r.Header.Get("Content-Type") != "application/x-ndjson" || r.Header.Get("Authorization") != "Bearer token" {
+		t.Fatalf("unexpected headers %v", r.Header)
+	}
+
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHTTPSinkElasticBulk(t *testing.T) {
+	c := newCollector()
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	sink, err := NewHTTPSink(&HTTPSinkConfig{
+		URL:             srv.URL + "/_bulk",
+		Format:          HTTPFormatElasticBulk,
+		IndexDateFormat: "2006.01.02",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = sink.Write(testEntries(0, 2)); err != nil {
+		t.Fatal(err)
+	}
+	// Close sends what is queued without waiting BatchWait
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.wait(t, 1)
+	_, bodies := c.snapshot()
+	action := `{"index":{"_index":"klyn-2018.06.01"}}`
+	want := action + "\n" + wantLine(0) + "\n" + action + "\n" + wantLine(1) + "\n"
+	if bodies[0] != want {
+		t.Fatalf("want %s, got %s", want, bodies[0])
+	}
+}
+
+func TestHTTPSinkLoki(t *testing.T) {
+	c := newCollector()
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	sink, err := NewHTTPSink(&HTTPSinkConfig{
+		URL:     srv.URL + "/loki/api/v1/push",
+		Format:  HTTPFormatLoki,
+		Encoder: EncoderFunc(func(e *Entry) ([]byte, error) { return []byte("line\n"), nil }),
+		Labels:  map[string]string{"app": "game"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := testEntries(0, 3)
+	entries[1].Level = LoggerLevelError
+	if err = sink.Write(entries); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.wait(t, 1)
+	reqs, bodies := c.snapshot()
+	if reqs[0].Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected content type %s", reqs[0].Header.Get("Content-Type"))
+	}
+
+	ts := "1527847200000000000"
+	want := `{"streams":[` +
+		`{"stream":{"app":"game","level":"info","prefix":"KLYN"},"values":[["` + ts + `","line"],["` + ts + `","line"]]},` +
+		`{"stream":{"app":"game","level":"error","prefix":"KLYN"},"values":[["` + ts + `","line"]]}]}`
+	if bodies[0] != want {
+		t.Fatalf("want %s, got %s", want, bodies[0])
+	}
+}
+
+func TestHTTPSinkRetry(t *testing.T) {
+	c := newCollector(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	sink, err := NewHTTPSink(&HTTPSinkConfig{URL: srv.URL, MinBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = sink.Write(testEntries(0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.wait(t, 3)
+	_, bodies := c.snapshot()
+	if len(bodies) != 3 || bodies[2] != wantLine(0)+"\n" {
+		t.Fatalf("unexpected bodies %v", bodies)
+	}
+
+	if sink.Dropped() != 0 || sink.DeadLettered() != 0 {
+		t.Fatalf("want nothing lost, got %d dropped, %d dead lettered", sink.Dropped(), sink.DeadLettered())
+	}
+}
+
+func TestHTTPSinkDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	deadLetter := filepath.Join(dir, "dead", "letter.log")
+
+	c := newCollector(500, 500, 500, http.StatusBadRequest)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	sink, err := NewHTTPSink(&HTTPSinkConfig{
+		URL:        srv.URL,
+		BatchSize:  2,
+		MaxRetries: 2,
+		MinBackoff: time.Millisecond,
+		DeadLetter: deadLetter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// first batch fails 3 times, second batch is rejected and not retried
+	if err = sink.Write(testEntries(0, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if reqs, _ := c.snapshot(); len(reqs) != 4 {
+		t.Fatalf("want 4 requests, got %d", len(reqs))
+	}
+
+	if sink.DeadLettered() != 4 {
+		t.Fatalf("want 4 dead lettered, got %d", sink.DeadLettered())
+	}
+
+	file, err := os.Open(deadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var i int
+	s := bufio.NewScanner(file)
+	for ; s.Scan(); i++ {
+		if s.Text() != wantLine(i) {
+			t.Fatalf("want %s, got %s", wantLine(i), s.Text())
+		}
+
+		var v interface{}
+		if err = json.Unmarshal(s.Bytes(), &v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if i != 4 {
+		t.Fatalf("want 4 lines, got %d", i)
+	}
+}
+
+func TestHTTPSinkCloseTimeout(t *testing.T) {
+	c := newCollector(500, 500, 500, 500)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	sink, err := NewHTTPSink(&HTTPSinkConfig{
+		URL:          srv.URL,
+		MinBackoff:   time.Hour,
+		CloseTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = sink.Write(testEntries(0, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = sink.Close(); err == nil {
+		t.Fatal("want close timeout error")
+	}
+
+	if sink.Dropped() != 2 {
+		t.Fatalf("want 2 dropped, got %d", sink.Dropped())
+	}
+
+	if err = sink.Write(testEntries(0, 1)); err == nil {
+		t.Fatal("want error writing to closed sink")
+	}
+}
+
+func TestHTTPSinkBulkItemErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	deadLetter := filepath.Join(dir, "letter.log")
+
+	// response of many items is larger than error message read
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		n := bytes.Count(body, []byte("\n")) / 2
+		buf := new(bytes.Buffer)
+		buf.WriteString(`{"took":1,"errors":true,"items":[`)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if i == 7 {
+				buf.WriteString(`{"index":{"_index":"klyn","status":400,"error":{"type":"mapper_parsing_exception"}}}`)
+				continue
+			}
+			fmt.Fprintf(buf, `{"index":{"_index":"klyn","_id":"%0200d","status":201,"error":null}}`, i)
+		}
+		buf.WriteString(`]}`)
+		_, _ = w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	sink, err := NewHTTPSink(&HTTPSinkConfig{
+		URL:        srv.URL + "/_bulk",
+		Format:     HTTPFormatElasticBulk,
+		DeadLetter: deadLetter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = sink.Write(testEntries(0, 500)); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(deadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != wantLine(7)+"\n" || sink.DeadLettered() != 1 {
+		t.Fatalf("want only failed item dead lettered, got %d:\n%s", sink.DeadLettered(), b)
+	}
+}
+
+func TestReadBulkResponse(t *testing.T) {
+	if err := readBulkResponse(strings.NewReader(`{"took":1,"errors":false,"items":[{"index":{"status":201}}]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// truncated or not json
+	for _, body := range []string{`{"took":1,"errors":false,"ite`, `<html>bad gateway</html>`} {
+		if err := readBulkResponse(strings.NewReader(body)); err == nil {
+			t.Fatalf("want error of %s", body)
+		}
+	}
+
+	err := readBulkResponse(strings.NewReader(`{"errors":true,"items":[]}`))
+	if berr, ok := err.(*bulkError); !ok || berr.failed != nil {
+		t.Fatalf("want whole batch failed, got %v", err)
+	}
+}
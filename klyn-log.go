@@ -6,14 +6,12 @@ package klynlog
 
 import (
 	"bytes"
-	"fmt"
+	"errors"
 	"io"
 	"log"
 	"os"
-	"os/signal"
 	"sync"
 	"sync/atomic"
-	"syscall"
 	"time"
 
 	"github.com/yusank/klyn-log/consts"
@@ -31,79 +29,128 @@ var (
 
 // KlynLog - implement Logger and provide cache
 type KlynLog struct {
-	config    *LoggerConfig
+	pipeline   atomic.Value // *pipeline, replaced as a whole by Reload
+	reloadLock *sync.Mutex
+	// flushLock - held for read while records are written into log file and sinks of config,
+	// for write by Reload and Close, so sinks are never written after closed
+	flushLock *sync.RWMutex
+	offFlag    uint32
+	done       chan struct{} // closed by Close, stops monitor and config watchers
+	closeOnce  *sync.Once
+
 	logWriter *logWriter // log final destination
 	cache     *logCache  // log temp cache
+	counters  *logStats
+
+	hooks    []Hook // replaced rather than appended in place, so log reads without lock
+	hookLock *sync.RWMutex
 }
 
 // LoggerConfig - logger config
 type LoggerConfig struct {
-	offFlag uint32
-
 	FlushMode int // flush dick mode
 	IsDebug   bool
 	Prefix    string
+	Dir       string // log file directory, consts.DefaultLogDir if empty
+
+	// Level - records below it are discarded, custom levels are compared by value. all logged if zero
+	Level Level
+	// Sampling - limit records logged per level per tick, all logged if nil
+	Sampling *Sampling
+	// Encoder - encoder of log file lines and debug output, TextEncoder if nil
+	Encoder Encoder
+
+	// MaxFileSize - log file is renamed to PREFIX-2006-01-02.N.log once it reaches
+	// MaxFileSize bytes, and a new one is opened. no limit if zero
+	MaxFileSize int64
+	// MaxAge - log files of days ended more than MaxAge ago are removed
+	// when a log file is opened. kept forever if zero
+	MaxAge time.Duration
+
+	// Redactors - applied in order on a copy of payload before it is encoded,
+	// so redacted values never reach hooks, log file or debug output
+	Redactors []Redactor
+	// Hooks - fired in order after redaction, more can be added by KlynLog.AddHook.
+	// not replaced by Reload
+	Hooks []Hook
+	// Sinks - entries are delivered to sinks in addition to log file on every flush
+	Sinks []Sink
+	// Metrics - receives counters of records, bytes, errors, flush durations and cache
+	// occupancy of logger and its sinks, none reported if nil
+	Metrics Metrics
+
+	// SpoolPath - write-ahead file cached records are appended to before log returns,
+	// moved aside and removed once flushed. records left by a crash or kill -9 are
+	// replayed into log file and sinks by NewLogger with same SpoolPath.
+	// no spool if empty, or FlushModeEveryLog
+	SpoolPath string
+
+	// Durability - when log file is fsynced, one of consts.DurabilityXXX, DurabilityNone by default
+	Durability int
+	// SyncInterval - fsync interval of DurabilityInterval, consts.DefaultSyncInterval if zero
+	SyncInterval time.Duration
+	// SyncLevel - records at or above it are fsynced once logged in DurabilityLevel,
+	// custom levels are compared by value. LoggerLevelError if zero
+	SyncLevel Level
 }
 
 // NewLogger return Logger
 func NewLogger(l *LoggerConfig) Logger {
+	return newLogger(l, nil)
+}
+
+// newLogger - create logger of l, which is converted from source if not nil
+func newLogger(l *LoggerConfig, source *Config) *KlynLog {
 	cache := &logCache{
 		buf:       new(bytes.Buffer),
 		cacheLock: new(sync.RWMutex),
-		ticker:    time.NewTicker(consts.DefaultTickerDuration),
-		syncChan:  make(chan bool, 0),
-		errChan:   make(chan error, 0),
 	}
 	logger := &KlynLog{
-		config: l,
-		cache:  cache,
+		reloadLock: new(sync.Mutex),
+		flushLock:  new(sync.RWMutex),
+		done:       make(chan struct{}),
+		closeOnce:  new(sync.Once),
+		logWriter: &logWriter{
+			writerLock:  new(sync.RWMutex),
+			stats:       new(syncStats),
+			syncOnClose: l.Durability != consts.DurabilityNone,
+		},
+		cache:    cache,
+		counters: new(logStats),
+		hooks:    append([]Hook(nil), l.Hooks...),
+		hookLock: new(sync.RWMutex),
 	}
+	logger.pipeline.Store(newPipeline(l, source))
+	instrumentSinks(l)
 
-	if err := utils.CreateIfNotExist(consts.DefaultLogDir); err != nil {
+	if err := utils.CreateIfNotExist(logger.dir()); err != nil {
 		panic(err)
 	}
 
-	go logger.monitor()
+	if l.SpoolPath != "" {
+		if err := logger.replaySpool(l.SpoolPath); err != nil {
+			log.Printf("klynlog: replay spool failed:%v", err)
+		}
 
-	c := make(chan os.Signal)
-	// 监听信号量
-	// SIGHUP: 终端结束进程(终端连接断开)
-	// SIGTERM: 结束程序
-	// SIGINT: Ctrl+ c 操作
-	// SIGQUIT: Ctrl+ / 操作
-	// SIGUSR1, SIGUSR2 用户保留
-	signal.Notify(c, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT,
-		syscall.SIGUSR1, syscall.SIGUSR2)
-
-	go func() {
-		for {
-			// 如捕捉到监听的信号，将内存中的日志写入文件
-			s := <-c
-			log.Println("catch signal:", s.String())
-			_ = logger.syncAndFlushCache()
-			switch s {
-			// 如果为退出信号 则安全退出
-			case syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT:
-				os.Exit(0)
-			// 可以通过给进程发送 syscall.SIGUSR1, syscall.SIGUSR2 信号来，强制将缓存中的日志写入文件
-			default:
-				log.Fatal(s.String())
+		if !logger.isFlushEveryLog() {
+			s, err := openSpool(l.SpoolPath)
+			if err != nil {
+				panic(err)
 			}
+			cache.spool = s
 		}
-	}()
+	}
+
+	go logger.monitor()
+
+	track(logger)
 
 	return logger
 }
 
-// DefaultLogger - get default logger
+// DefaultLogger - get default logger, same as Default
 func DefaultLogger() Logger {
-	conf := &LoggerConfig{
-		Prefix:    "KLYN",
-		FlushMode: consts.FlushModeByDuration,
-		IsDebug:   true,
-	}
-
-	return NewLogger(conf)
+	return Default()
 }
 
 // Trace - trace level log
@@ -147,133 +194,396 @@ func (kl *KlynLog) OFF() {
 	kl.setOffAtomic()
 }
 
+// AddHook - add hook fired after hooks already added
+func (kl *KlynLog) AddHook(h Hook) {
+	kl.hookLock.Lock()
+	defer kl.hookLock.Unlock()
+
+	hooks := make([]Hook, len(kl.hooks), len(kl.hooks)+1)
+	copy(hooks, kl.hooks)
+	kl.hooks = append(hooks, h)
+}
+
+func (kl *KlynLog) getHooks() []Hook {
+	kl.hookLock.RLock()
+	defer kl.hookLock.RUnlock()
+
+	return kl.hooks
+}
+
 func (kl *KlynLog) log(l Level, j interface{}) {
-	if kl.isOff() || j == nil {
+	p := kl.load()
+	c := p.config
+	if kl.isOff() || j == nil || l < kl.levelOf(p) {
 		return
 	}
 
-	b, _ := json.Marshal(j)
+	if p.sampler != nil && !p.sampler.sample(l, time.Now()) {
+		kl.drop(c, "sampled")
+		return
+	}
+
+	if c.Metrics != nil {
+		c.Metrics.Counter(metricRecords, 1, "prefix", c.Prefix, "level", l.String())
+	}
 
-	line := fmt.Sprintf("[%s] | LEVEL:%s | message:%s\n", kl.config.Prefix, l.String(), string(b))
-	if kl.config.IsDebug {
-		log.Printf(line)
+	e := &Entry{
+		Prefix: c.Prefix,
+		Time:   time.Now(),
+		Level:  l,
+		Data:   j,
 	}
 
-	if kl.isFlushEveryLog() {
+	if len(c.Redactors) > 0 {
+		data, err := redact(c.Redactors, j)
+		if err != nil {
+			// payload can not be redacted, drop it rather than leak it
+			kl.drop(c, "redact")
+			return
+		}
+
+		e.Data = data
+	}
+
+	entries := []*Entry{e}
+	if hooks := kl.getHooks(); len(hooks) > 0 {
+		entries = fireHooks(hooks, e)
+	}
+
+	for _, e := range entries {
+		if len(c.Sinks) > 0 && len(c.Redactors) == 0 {
+			// payload is read by sinks after log returns, keep a copy in case caller changes it
+			e.Data, _ = jsonValue(e.Data)
+		}
+
+		kl.writeEntry(c, e)
+	}
+}
+
+// writeEntry - encode entry and write it into cache, or io directly when flush every log
+func (kl *KlynLog) writeEntry(c *LoggerConfig, e *Entry) {
+	line, err := encoderOf(c).Encode(e)
+	if err != nil {
+		kl.drop(c, "encode")
+		return
+	}
+
+	if c.IsDebug {
+		log.Print(string(line))
+	}
+
+	if c.FlushMode == consts.FlushModeEveryLog {
 		// if flush every log to io, then no need to write to cache
-		_ = kl.writeToIO([]byte(line))
+		kl.flushLock.RLock()
+		_ = kl.writeToIO(line, 1, kl.syncOnFlush() || kl.syncOnLevel(e.Level))
+		kl.writeToSinks([]*Entry{e})
+		kl.flushLock.RUnlock()
 		return
 	}
 
-	if err := kl.cache.write([]byte(line)); err != nil {
+	spoolErr, err := kl.cache.write(line, e, len(c.Sinks) > 0)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	return
+	if spoolErr != nil {
+		kl.spoolFailed(c, spoolErr)
+	}
+
+	if spoolErr != nil || kl.syncOnLevel(e.Level) {
+		// record should be on disk once log returns, flush it with whatever cached before it
+		_ = kl.syncAndFlushCache()
+		if err = kl.logWriter.sync(); err != nil {
+			log.Printf("klynlog: sync log file failed:%v", err)
+		}
+	}
+}
+
+// spoolFailed - count record not spooled, it is flushed at once as it is not crash safe in cache
+func (kl *KlynLog) spoolFailed(c *LoggerConfig, err error) {
+	atomic.AddUint64(&kl.counters.spoolErrors, 1)
+	if c.Metrics != nil {
+		c.Metrics.Counter(metricWriteErrors, 1, "prefix", c.Prefix, "sink", "spool", "target", c.SpoolPath)
+	}
+	log.Printf("klynlog: write spool failed:%v", err)
+}
+
+// drop - count record discarded for reason
+func (kl *KlynLog) drop(c *LoggerConfig, reason string) {
+	atomic.AddUint64(&kl.counters.dropped, 1)
+	if c.Metrics != nil {
+		c.Metrics.Counter(metricDropped, 1, "prefix", c.Prefix, "reason", reason)
+	}
 }
 
 // isOff - is log off
 func (kl *KlynLog) isOff() bool {
-	return kl.config.offFlag == 1
+	return atomic.LoadUint32(&kl.offFlag) == 1
+}
+
+// encoder - encoder of log file lines
+func (kl *KlynLog) encoder() Encoder {
+	return encoderOf(kl.conf())
+}
+
+func encoderOf(c *LoggerConfig) Encoder {
+	if c.Encoder == nil {
+		return TextEncoder{}
+	}
+
+	return c.Encoder
+}
+
+// dir - log file directory
+func (kl *KlynLog) dir() string {
+	return dirOf(kl.conf())
+}
+
+func dirOf(c *LoggerConfig) string {
+	if c.Dir == "" {
+		return consts.DefaultLogDir
+	}
+
+	return c.Dir
 }
 
 // isFlushEveryLog -  is flush mode is FlushModeEveryLog
 func (kl *KlynLog) isFlushEveryLog() bool {
-	return kl.config.FlushMode == consts.FlushModeEveryLog
+	return kl.conf().FlushMode == consts.FlushModeEveryLog
 }
 
 func (kl *KlynLog) setOffAtomic() {
-	atomic.StoreUint32(&kl.config.offFlag, 1)
+	atomic.StoreUint32(&kl.offFlag, 1)
 }
 
 func (kl *KlynLog) isWriterClosed() bool {
-	return kl.logWriter == nil || kl.logWriter.writer == nil
-}
+	kl.logWriter.writerLock.RLock()
+	defer kl.logWriter.writerLock.RUnlock()
 
-func (kl *KlynLog) isWriterValid() bool {
-	return kl.logWriter != nil && kl.logWriter.writer != nil
+	return kl.logWriter.writer == nil
 }
 
 // syncAndFlushCache - sync log from cache to io.writer and flush cache
 func (kl *KlynLog) syncAndFlushCache() error {
+	kl.flushLock.RLock()
+	defer kl.flushLock.RUnlock()
+
+	return kl.flushLocked()
+}
+
+// flushLocked - syncAndFlushCache with flushLock held
+func (kl *KlynLog) flushLocked() error {
 	// already locked so no need to call `cacheLen()`
 	if kl.cache.length() == 0 {
 		return nil
 	}
 
-	cache, err := kl.cache.popCache()
+	cache, n, entries, spooled, err := kl.cache.popCache()
 	if err != nil {
 		return err
 	}
 
-	err = kl.writeToIO(cache)
+	start := time.Now()
+	err = kl.writeToIO(cache, n, kl.syncOnFlush())
+	kl.writeToSinks(entries)
+	if c := kl.conf(); c.Metrics != nil {
+		c.Metrics.Histogram(metricFlushSeconds, time.Since(start).Seconds(), "prefix", c.Prefix)
+		c.Metrics.Gauge(metricCacheBytes, float64(kl.cacheLen()), "prefix", c.Prefix)
+	}
 	if err != nil {
 		return err
 	}
 
+	if spooled != "" {
+		return kl.cache.getSpool().remove(spooled)
+	}
+
 	return nil
 }
 
-// writeToIO get writer and write b into
+// writeToSinks - deliver entries to every sink, failure of one sink does not stop others
+func (kl *KlynLog) writeToSinks(entries []*Entry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	c := kl.conf()
+	for _, sink := range c.Sinks {
+		if err := sink.Write(entries); err != nil {
+			atomic.AddUint64(&kl.counters.sinkErrors, 1)
+			if c.Metrics != nil {
+				c.Metrics.Counter(metricSinkErrors, 1, "prefix", c.Prefix)
+			}
+			log.Printf("klynlog: write to sink failed:%v", err)
+		}
+	}
+}
+
+// Flush - write cached records into log file and sinks now
+func (kl *KlynLog) Flush() error {
+	return kl.syncAndFlushCache()
+}
+
+// Reopen - flush cache and close log file, it is opened again by next write.
+// records go to a new file once log file is moved away, like by logrotate
+func (kl *KlynLog) Reopen() error {
+	err := kl.syncAndFlushCache()
+	if cerr := kl.logWriter.close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// Close - flush cache, close log file and sinks.
+// logger should not be used after closed.
+func (kl *KlynLog) Close() error {
+	untrack(kl)
+	kl.setOffAtomic()
+	kl.closeOnce.Do(func() { close(kl.done) })
+
+	// wait for Reload in progress, sinks it replaced are closed by it
+	kl.reloadLock.Lock()
+	defer kl.reloadLock.Unlock()
+
+	// wait for flush in progress, none starts after
+	kl.flushLock.Lock()
+	defer kl.flushLock.Unlock()
+
+	err := kl.flushLocked()
+
+	if cerr := kl.logWriter.close(); cerr != nil && err == nil {
+		err = cerr
+	}
+
+	if s := kl.cache.getSpool(); s != nil {
+		if cerr := s.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	for _, sink := range kl.conf().Sinks {
+		if cerr := sink.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// writeToIO get writer and write b of n records into, fsync after write if sync
 // lock when write and close writer after write
-func (kl *KlynLog) writeToIO(b []byte) (err error) {
+func (kl *KlynLog) writeToIO(b []byte, n int, sync bool) (err error) {
 	if err = kl.getIOWriter(); err != nil {
 		return
 	}
 
-	if err = kl.logWriter.write(b); err != nil {
-		fmt.Println(err)
+	err = kl.logWriter.write(b, sync)
+	if err == errWriterClosed {
+		// closed by MaintainIOWriter after checked, open it again
+		if err = kl.getIOWriter(); err != nil {
+			return
+		}
+
+		err = kl.logWriter.write(b, sync)
 	}
 
+	c := kl.conf()
+	if err != nil {
+		atomic.AddUint64(&kl.counters.writeErrors, 1)
+		if c.Metrics != nil {
+			c.Metrics.Counter(metricWriteErrors, 1, "prefix", c.Prefix, "sink", "file", "target", dirOf(c))
+		}
+		log.Printf("klynlog: write log file failed:%v", err)
+		return err
+	}
+
+	kl.counters.wrote(n, len(b))
+	if c.Metrics != nil {
+		c.Metrics.Counter(metricWrittenBytes, float64(len(b)), "prefix", c.Prefix, "sink", "file", "target", dirOf(c))
+	}
 	return nil
 }
 
-// getIOWriter get log final writer and set for kl.logWriter
+// getIOWriter get log final writer and set for kl.logWriter.
+// file of a new day is opened after midnight, file reached MaxFileSize is rotated,
+// and file of new Prefix or Dir is opened once reloaded.
 func (kl *KlynLog) getIOWriter() (err error) {
-	// io writer still valid
-	if kl.isWriterValid() {
-		return
+	lw := kl.logWriter
+	lw.writerLock.Lock()
+	defer lw.writerLock.Unlock()
+
+	c := kl.conf()
+	day := time.Now().Format(consts.LogFileDateFormat)
+	dir := dirOf(c)
+	fileName := logFileName(dir, c.Prefix, day)
+	maxSize := c.MaxFileSize
+	if lw.writer != nil {
+		// io writer still valid
+		if lw.path == fileName && (maxSize <= 0 || lw.size < maxSize) {
+			return
+		}
+
+		if err = lw.closeLocked(); err != nil {
+			return
+		}
+	}
+
+	if info, serr := os.Stat(fileName); serr == nil && maxSize > 0 && info.Size() >= maxSize {
+		if err = rotateLogFile(dir, c.Prefix, day); err != nil {
+			return
+		}
 	}
 
-	day := time.Now().Format("2006-01-02")
-	fileName := fmt.Sprintf("%s/%s-%s.log", consts.DefaultLogDir, kl.config.Prefix, day)
 	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		return
 	}
 
-	if kl.logWriter == nil {
-		kl.logWriter = &logWriter{
-			writerLock: new(sync.RWMutex),
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	if c.MaxAge > 0 {
+		if rerr := removeExpiredLogFiles(dir, c.Prefix, c.MaxAge); rerr != nil {
+			log.Printf("klynlog: remove expired log files failed:%v", rerr)
 		}
 	}
 
-	kl.logWriter.writer = file
+	lw.writer = file
+	lw.path = fileName
+	lw.size = info.Size()
 
 	return nil
 }
 
 // MaintainIOWriter - maintain kl io writer, in case opened and closed too frequently.
-// only run flush every log mode
+// only run flush every log mode, monitor of logger already does it
 func (kl *KlynLog) MaintainIOWriter() {
-	var ts int64
 	for {
-		if kl.isWriterClosed() {
-			goto sleep
-		}
+		kl.closeIdleWriter()
+		time.Sleep(100 * time.Millisecond)
+	}
+}
 
-		kl.logWriter.writerLock.RLock()
+// closeIdleWriter - close log file not written for a second
+func (kl *KlynLog) closeIdleWriter() {
+	if kl.isWriterClosed() {
+		return
+	}
 
-		ts = time.Now().UnixNano()
-		if kl.logWriter.lastWrite != 0 && ts-kl.logWriter.lastWrite > int64(1*time.Second) && kl.logWriter.writer != nil {
-			if err := kl.logWriter.close(); err != nil {
-				log.Fatal(err)
-			}
-		}
-		kl.logWriter.writerLock.RUnlock()
+	kl.logWriter.writerLock.RLock()
+	ts := time.Now().UnixNano()
+	idle := kl.logWriter.lastWrite != 0 && ts-kl.logWriter.lastWrite > int64(1*time.Second) && kl.logWriter.writer != nil
+	// close takes write lock, release read lock first
+	kl.logWriter.writerLock.RUnlock()
 
-	sleep:
-		time.Sleep(100 * time.Millisecond)
+	if idle {
+		if err := kl.logWriter.close(); err != nil {
+			log.Fatal(err)
+		}
 	}
 }
 
@@ -286,71 +596,94 @@ func (kl *KlynLog) cacheLen() (n int) {
 	return
 }
 
-// monitor - monitoring syncChan chan, flush cache once channel receive value
+// monitor - flush cache, close idle log file and fsync it as current flush mode and
+// durability require, until logger closed. config is read every tick so reloaded one
+// takes effect without restart.
 func (kl *KlynLog) monitor() {
-	// only monitor syncChan chan when need monitoring
-	switch kl.config.FlushMode {
-	case consts.FlushModeBySize:
-		go kl.sizeMonitor()
-	case consts.FlushModeByDuration:
-		go kl.durationMonitor()
-	case consts.FlushModeEveryLog:
-		go kl.MaintainIOWriter()
-	// other mode no need to monitoring syncChan chan
-	default:
-		return
-	}
+	ticker := time.NewTicker(monitorTick)
+	defer ticker.Stop()
 
+	lastFlush, lastSync, lastMaintain := time.Now(), time.Now(), time.Now()
 	for {
+		var now time.Time
 		select {
-		case <-kl.cache.syncChan:
-			if err := kl.syncAndFlushCache(); err != nil {
-				panic(err)
-			}
-		case e := <-kl.cache.errChan:
-			fmt.Println("err:", e)
+		case <-kl.done:
 			return
+		case now = <-ticker.C:
 		}
-	}
-}
 
-// sizeMonitor - check cache size every 10 millisecond.
-// Send a value to syncChan channel when cache size large then MaxSizeOfCache
-func (kl *KlynLog) sizeMonitor() {
-	for {
-		if kl.cacheLen() >= consts.MaxSizeOfCache {
-			kl.cache.syncChan <- true
-		} else {
-			time.Sleep(time.Millisecond * 10)
+		c := kl.conf()
+		if c.Metrics != nil {
+			c.Metrics.Gauge(metricCacheBytes, float64(kl.cacheLen()), "prefix", c.Prefix)
 		}
-	}
-}
 
-// durationMonitor - send value to syncChan when every tick
-func (kl *KlynLog) durationMonitor() {
-	for {
-		select {
-		case <-kl.cache.ticker.C:
-			kl.cache.syncChan <- true
+		flush := false
+		switch c.FlushMode {
+		case consts.FlushModeBySize:
+			// check cache size every tick, flush once large then MaxSizeOfCache
+			flush = kl.cacheLen() >= consts.MaxSizeOfCache
+		case consts.FlushModeByDuration:
+			flush = now.Sub(lastFlush) >= consts.DefaultTickerDuration
+		case consts.FlushModeEveryLog:
+			// records cached before flush mode reloaded
+			flush = kl.cacheLen() > 0
+			if now.Sub(lastMaintain) >= 100*time.Millisecond {
+				kl.closeIdleWriter()
+				lastMaintain = now
+			}
+		}
+
+		if flush {
+			// counted and logged by writeToIO, spooled records are kept for replay
+			_ = kl.syncAndFlushCache()
+			lastFlush = now
+		}
+
+		if c.Durability == consts.DurabilityInterval && now.Sub(lastSync) >= syncIntervalOf(c) {
+			if err := kl.logWriter.sync(); err != nil {
+				log.Printf("klynlog: sync log file failed:%v", err)
+			}
+			lastSync = now
 		}
 	}
 }
 
+// monitorTick - how often monitor checks cache
+const monitorTick = 10 * time.Millisecond
+
 type logCache struct {
 	buf       *bytes.Buffer
-	ticker    *time.Ticker
-	syncChan  chan bool
-	errChan   chan error
+	records   int      // records in buf
+	entries   []*Entry // entries of buf, kept only when there are sinks
+	spool     *spool   // nil if LoggerConfig.SpoolPath is empty, or opened by Reload
 	cacheLock *sync.RWMutex
 }
 
-// writeCache - write log to cache at first
-func (lc *logCache) write(b []byte) error {
+func (lc *logCache) getSpool() *spool {
+	lc.cacheLock.RLock()
+	defer lc.cacheLock.RUnlock()
+
+	return lc.spool
+}
+
+// writeCache - write log to cache at first, spoolErr is error of writing spool, record is cached anyway
+func (lc *logCache) write(b []byte, e *Entry, keepEntry bool) (spoolErr, err error) {
 	lc.cacheLock.Lock()
 	defer lc.cacheLock.Unlock()
 
-	_, err := lc.buf.Write(b)
-	return err
+	if lc.spool != nil {
+		spoolErr = lc.spool.write(e)
+	}
+
+	_, err = lc.buf.Write(b)
+	if err == nil {
+		lc.records++
+		if keepEntry {
+			lc.entries = append(lc.entries, e)
+		}
+	}
+
+	return
 }
 
 func (lc *logCache) length() int {
@@ -361,8 +694,8 @@ func (lc *logCache) length() int {
 	return l
 }
 
-// read and reset cache
-func (lc *logCache) popCache() (p []byte, err error) {
+// read and reset cache of n records, spooled is spool file of records read, to be removed after they are flushed
+func (lc *logCache) popCache() (p []byte, n int, entries []*Entry, spooled string, err error) {
 	lc.cacheLock.Lock()
 	defer lc.cacheLock.Unlock()
 
@@ -372,22 +705,78 @@ func (lc *logCache) popCache() (p []byte, err error) {
 		return
 	}
 
+	n, lc.records = lc.records, 0
+	entries, lc.entries = lc.entries, nil
 	lc.buf.Reset()
+
+	if lc.spool != nil {
+		if spooled, err = lc.spool.rotate(); err != nil {
+			// records are flushed anyway, they are only not crash safe until next rotate
+			log.Printf("klynlog: rotate spool failed:%v", err)
+			err = nil
+		}
+	}
 	return
 }
 
 type logWriter struct {
 	lastWrite  int64 // last write time stamp
+	dirty      bool  // written since last fsync
+	path       string
+	size       int64 // size of file being written
 	writer     io.WriteCloser
 	writerLock *sync.RWMutex
+
+	stats       *syncStats
+	syncOnClose bool // fsync what is not yet before close, unless DurabilityNone
 }
 
-func (lw *logWriter) write(b []byte) error {
+var errWriterClosed = errors.New("klynlog: log writer closed")
+
+func (lw *logWriter) write(b []byte, sync bool) error {
 	lw.writerLock.Lock()
 	defer lw.writerLock.Unlock()
 
-	_, err := lw.writer.Write(b)
+	if lw.writer == nil {
+		return errWriterClosed
+	}
+
+	n, err := lw.writer.Write(b)
 	lw.lastWrite = time.Now().UnixNano()
+	lw.dirty = true
+	lw.size += int64(n)
+	if err == nil && sync {
+		err = lw.syncLocked()
+	}
+
+	return err
+}
+
+// sync - fsync writer if written since last fsync
+func (lw *logWriter) sync() error {
+	lw.writerLock.Lock()
+	defer lw.writerLock.Unlock()
+
+	return lw.syncLocked()
+}
+
+func (lw *logWriter) syncLocked() error {
+	if lw.writer == nil || !lw.dirty {
+		return nil
+	}
+
+	syncer, ok := lw.writer.(interface{ Sync() error })
+	if !ok {
+		return nil
+	}
+
+	start := time.Now()
+	err := syncer.Sync()
+	lw.stats.record(time.Since(start), err)
+	if err == nil {
+		lw.dirty = false
+	}
+
 	return err
 }
 
@@ -395,6 +784,23 @@ func (lw *logWriter) close() error {
 	lw.writerLock.Lock()
 	defer lw.writerLock.Unlock()
 
-	err := lw.writer.Close()
+	return lw.closeLocked()
+}
+
+func (lw *logWriter) closeLocked() error {
+	if lw.writer == nil {
+		return nil
+	}
+
+	var err error
+	if lw.syncOnClose {
+		err = lw.syncLocked()
+	}
+
+	if cerr := lw.writer.Close(); err == nil {
+		err = cerr
+	}
+	lw.writer = nil
+	lw.dirty = false
 	return err
 }
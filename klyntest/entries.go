@@ -0,0 +1,144 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klyntest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	klynlog "github.com/yusank/klyn-log"
+)
+
+// Entries - recorded entries, payloads are json decoded copies,
+// so objects are map[string]interface{} and numbers are json.Number
+type Entries []*klynlog.Entry
+
+// Len - number of entries
+func (es Entries) Len() int {
+	return len(es)
+}
+
+// Filter - entries f returns true for
+func (es Entries) Filter(f func(e *klynlog.Entry) bool) Entries {
+	var filtered Entries
+	for _, e := range es {
+		if f(e) {
+			filtered = append(filtered, e)
+		}
+	}
+
+	return filtered
+}
+
+// FilterLevel - entries of any of levels
+func (es Entries) FilterLevel(levels ...klynlog.Level) Entries {
+	return es.Filter(func(e *klynlog.Entry) bool {
+		for _, l := range levels {
+			if e.Level == l {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// fieldValue - field of payload at dotted path like "event.gameId"
+func fieldValue(e *klynlog.Entry, path string) (interface{}, bool) {
+	var cur interface{} = e.Data
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+// FilterField - entries with field at dotted path equals value,
+// values are compared by their printed form, so 1234 matches json.Number("1234")
+func (es Entries) FilterField(path string, value interface{}) Entries {
+	want := fmt.Sprint(value)
+	return es.Filter(func(e *klynlog.Entry) bool {
+		v, ok := fieldValue(e, path)
+		return ok && fmt.Sprint(v) == want
+	})
+}
+
+// FilterFieldKey - entries with field at dotted path
+func (es Entries) FilterFieldKey(path string) Entries {
+	return es.Filter(func(e *klynlog.Entry) bool {
+		_, ok := fieldValue(e, path)
+		return ok
+	})
+}
+
+// FilterMessage - entries logged with string msg as payload
+func (es Entries) FilterMessage(msg string) Entries {
+	return es.Filter(func(e *klynlog.Entry) bool {
+		s, ok := e.Data.(string)
+		return ok && s == msg
+	})
+}
+
+// FilterMessageSnippet - entries whose json encoded payload contains snippet
+func (es Entries) FilterMessageSnippet(snippet string) Entries {
+	return es.Filter(func(e *klynlog.Entry) bool {
+		b, err := json.Marshal(e.Data)
+		return err == nil && bytes.Contains(b, []byte(snippet))
+	})
+}
+
+// String - one encoded line per entry, used in failure messages
+func (es Entries) String() string {
+	buf := new(bytes.Buffer)
+	for _, e := range es {
+		line, _ := klynlog.TextEncoder{}.Encode(e)
+		buf.Write(line)
+	}
+
+	return buf.String()
+}
+
+// AssertLen - report error when number of entries is not n
+func AssertLen(t testing.TB, es Entries, n int) bool {
+	t.Helper()
+	if len(es) != n {
+		t.Errorf("want %d entries, got %d:\n%s", n, len(es), es)
+		return false
+	}
+
+	return true
+}
+
+// AssertLogged - report error when no entry matched
+func AssertLogged(t testing.TB, es Entries) bool {
+	t.Helper()
+	if len(es) == 0 {
+		t.Errorf("want entries logged, got none")
+		return false
+	}
+
+	return true
+}
+
+// AssertNotLogged - report error when any entry matched
+func AssertNotLogged(t testing.TB, es Entries) bool {
+	t.Helper()
+	if len(es) > 0 {
+		t.Errorf("want no entry logged, got %d:\n%s", len(es), es)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,117 @@
+package klyntest
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	klynlog "github.com/yusank/klyn-log"
+	"github.com/yusank/klyn-log/consts"
+)
+
+var (
+	_ klynlog.Logger = (*Observer)(nil)
+	_ klynlog.Hook   = (*Observer)(nil)
+	_ klynlog.Logger = (*TBLogger)(nil)
+)
+
+func TestObserver(t *testing.T) {
+	obs := NewObserver()
+	payload := map[string]interface{}{
+		"userId": 1234,
+		"event":  map[string]interface{}{"gameId": "dddjs"},
+	}
+
+	obs.Warn(payload)
+	obs.Error("connection refused")
+	obs.Info(struct {
+		UserID int `json:"userId"`
+	}{UserID: 5})
+	payload["userId"] = 0
+
+	all := obs.All()
+	AssertLen(t, all, 3)
+	AssertLen(t, all.FilterLevel(klynlog.LoggerLevelWarn, klynlog.LoggerLevelError), 2)
+	AssertLen(t, all.FilterField("userId", 1234), 1)
+	AssertLen(t, all.FilterField("userId", 5).FilterLevel(klynlog.LoggerLevelInfo), 1)
+	AssertLen(t, all.FilterField("event.gameId", "dddjs"), 1)
+	AssertLen(t, all.FilterFieldKey("event"), 1)
+	AssertLogged(t, all.FilterMessage("connection refused"))
+	AssertLogged(t, all.FilterMessageSnippet(`"gameId":"dddjs"`))
+	AssertNotLogged(t, all.FilterLevel(klynlog.LoggerLevelFatal))
+
+	if taken := obs.TakeAll(); taken.Len() != 3 || obs.Len() != 0 {
+		t.Fatalf("unexpected take all %d, left %d", taken.Len(), obs.Len())
+	}
+
+	obs.OFF()
+	obs.Info("ignored")
+	AssertLen(t, obs.All(), 0)
+}
+
+func TestObserverAsHook(t *testing.T) {
+	obs := NewObserver()
+	prefix := fmt.Sprintf("observer%d", time.Now().UnixNano())
+	logger := klynlog.NewLogger(&klynlog.LoggerConfig{
+		Prefix:    prefix,
+		FlushMode: consts.FlushModeEveryLog,
+		Redactors: []klynlog.Redactor{&klynlog.KeyRedactor{Keys: []string{"token"}}},
+		Hooks:     []klynlog.Hook{obs},
+	})
+	defer os.Remove(fmt.Sprintf("%s/%s-%s.log", consts.DefaultLogDir, prefix, time.Now().Format(consts.LogFileDateFormat)))
+
+	logger.Error(map[string]interface{}{"token": "secret", "userId": 1})
+	AssertLen(t, obs.All().FilterField("token", klynlog.DefaultMask).FilterField("userId", 1), 1)
+}
+
+type fakeTB struct {
+	testing.TB
+	lines   []string
+	helpers []string // functions marked as helper
+}
+
+func (f *fakeTB) Name() string            { return "TestFake" }
+func (f *fakeTB) Log(args ...interface{}) { f.lines = append(f.lines, fmt.Sprint(args...)) }
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.lines = append(f.lines, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Helper() {
+	pc, _, _, _ := runtime.Caller(1)
+	name := runtime.FuncForPC(pc).Name()
+	f.helpers = append(f.helpers, name[strings.LastIndex(name, ".")+1:])
+}
+
+func TestTBLogger(t *testing.T) {
+	tb := &fakeTB{}
+	logger := NewTBLogger(tb)
+	logger.Warn(map[string]interface{}{"userId": 1})
+	logger.OFF()
+	logger.Warn("ignored")
+
+	if len(tb.lines) != 1 ||
+		!strings.HasPrefix(tb.lines[0], "[TestFake] | TIME:") ||
+		!strings.HasSuffix(tb.lines[0], ` | LEVEL:warn | message:{"userId":1}`) {
+		t.Fatalf("unexpected lines %q", tb.lines)
+	}
+
+	// lines are reported at caller of logger
+	tb.helpers = nil
+	logger = NewTBLogger(tb)
+	logger.Trace(1)
+	logger.Debug(1)
+	logger.Info(1)
+	logger.Warn(1)
+	logger.Error(1)
+	logger.Fatal(1)
+	want := []string{"Trace", "Any", "Debug", "Any", "Info", "Any", "Warn", "Any", "Error", "Any", "Fatal", "Any"}
+	if strings.Join(tb.helpers, ",") != strings.Join(want, ",") {
+		t.Fatalf("want helpers %v, got %v", want, tb.helpers)
+	}
+
+	// real testing.T, shows with -v
+	NewTBLogger(t).Info("routed to t.Log")
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package klyntest provides loggers for testing code which logs,
+// entries are kept in memory or routed to testing.TB instead of files.
+package klyntest
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	klynlog "github.com/yusank/klyn-log"
+)
+
+// Observer - klynlog.Logger records entries in memory.
+// it is a klynlog.Hook as well, so entries of a real logger can be observed:
+//
+//	obs := klyntest.NewObserver()
+//	logger := klynlog.NewLogger(&klynlog.LoggerConfig{Hooks: []klynlog.Hook{obs}})
+type Observer struct {
+	Prefix string
+
+	offFlag uint32
+	lock    sync.RWMutex
+	entries Entries
+}
+
+// NewObserver - get observer with empty entries
+func NewObserver() *Observer {
+	return &Observer{Prefix: "TEST"}
+}
+
+// Trace - trace level log
+func (o *Observer) Trace(j interface{}) {
+	o.Any(klynlog.LoggerLevelTrace, j)
+}
+
+// Debug - debug level log
+func (o *Observer) Debug(j interface{}) {
+	o.Any(klynlog.LoggerLevelDebug, j)
+}
+
+// Info - info level log
+func (o *Observer) Info(j interface{}) {
+	o.Any(klynlog.LoggerLevelInfo, j)
+}
+
+// Warn - warn level log
+func (o *Observer) Warn(j interface{}) {
+	o.Any(klynlog.LoggerLevelWarn, j)
+}
+
+// Error - error level log
+func (o *Observer) Error(j interface{}) {
+	o.Any(klynlog.LoggerLevelError, j)
+}
+
+// Fatal - fatal level log
+func (o *Observer) Fatal(j interface{}) {
+	o.Any(klynlog.LoggerLevelFatal, j)
+}
+
+// Any - custom level log
+func (o *Observer) Any(l klynlog.Level, j interface{}) {
+	if atomic.LoadUint32(&o.offFlag) == 1 || j == nil {
+		return
+	}
+
+	o.record(&klynlog.Entry{
+		Prefix: o.Prefix,
+		Time:   time.Now(),
+		Level:  l,
+		Data:   j,
+	})
+}
+
+// OFF - stop recording
+func (o *Observer) OFF() {
+	atomic.StoreUint32(&o.offFlag, 1)
+}
+
+// Levels - implement klynlog.Hook, observe all levels
+func (o *Observer) Levels() []klynlog.Level {
+	return nil
+}
+
+// Fire - implement klynlog.Hook, record entry and pass it on
+func (o *Observer) Fire(e *klynlog.Entry) ([]*klynlog.Entry, error) {
+	o.record(e)
+	return []*klynlog.Entry{e}, nil
+}
+
+// record - keep json copy of entry, so later changes of payload by caller are not observed
+func (o *Observer) record(e *klynlog.Entry) {
+	c := *e
+	c.Data = jsonValue(e.Data)
+
+	o.lock.Lock()
+	o.entries = append(o.entries, &c)
+	o.lock.Unlock()
+}
+
+// All - all entries recorded, oldest first
+func (o *Observer) All() Entries {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	return append(Entries(nil), o.entries...)
+}
+
+// Len - number of entries recorded
+func (o *Observer) Len() int {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	return len(o.entries)
+}
+
+// TakeAll - return all entries and reset
+func (o *Observer) TakeAll() Entries {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	entries := o.entries
+	o.entries = nil
+	return entries
+}
+
+func jsonValue(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var val interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err = dec.Decode(&val); err != nil {
+		return v
+	}
+
+	return val
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klyntest
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	klynlog "github.com/yusank/klyn-log"
+)
+
+// TBLogger - klynlog.Logger writes encoded lines by t.Log,
+// so output shows up only when test fails or runs with -v
+type TBLogger struct {
+	t       testing.TB
+	enc     klynlog.Encoder
+	offFlag uint32
+}
+
+// NewTBLogger - logger writes into t with klynlog.TextEncoder, prefix is name of test
+func NewTBLogger(t testing.TB) *TBLogger {
+	return &TBLogger{t: t, enc: klynlog.TextEncoder{}}
+}
+
+// Trace - trace level log
+func (l *TBLogger) Trace(j interface{}) {
+	l.t.Helper()
+	l.Any(klynlog.LoggerLevelTrace, j)
+}
+
+// Debug - debug level log
+func (l *TBLogger) Debug(j interface{}) {
+	l.t.Helper()
+	l.Any(klynlog.LoggerLevelDebug, j)
+}
+
+// Info - info level log
+func (l *TBLogger) Info(j interface{}) {
+	l.t.Helper()
+	l.Any(klynlog.LoggerLevelInfo, j)
+}
+
+// Warn - warn level log
+func (l *TBLogger) Warn(j interface{}) {
+	l.t.Helper()
+	l.Any(klynlog.LoggerLevelWarn, j)
+}
+
+// Error - error level log
+func (l *TBLogger) Error(j interface{}) {
+	l.t.Helper()
+	l.Any(klynlog.LoggerLevelError, j)
+}
+
+// Fatal - fatal level log, test is not stopped
+func (l *TBLogger) Fatal(j interface{}) {
+	l.t.Helper()
+	l.Any(klynlog.LoggerLevelFatal, j)
+}
+
+// Any - custom level log
+func (l *TBLogger) Any(level klynlog.Level, j interface{}) {
+	l.t.Helper()
+	if atomic.LoadUint32(&l.offFlag) == 1 || j == nil {
+		return
+	}
+
+	line, err := l.enc.Encode(&klynlog.Entry{
+		Prefix: l.t.Name(),
+		Time:   time.Now(),
+		Level:  level,
+		Data:   j,
+	})
+	if err != nil {
+		l.t.Errorf("klyntest: encode entry failed:%v", err)
+		return
+	}
+
+	l.t.Log(strings.TrimSuffix(string(line), "\n"))
+}
+
+// OFF - stop writing into t
+func (l *TBLogger) OFF() {
+	atomic.StoreUint32(&l.offFlag, 1)
+}
@@ -2,41 +2,123 @@ package raft
 
 import (
 	"encoding/json"
-	"io"
 	"log"
 	"sync"
+	"time"
 )
 
 type cacheManager struct {
 	m sync.Map
 }
 
+// cacheEntry - value and deadline decided by leader, never expires if ExpireAt is zero
+type cacheEntry struct {
+	Value    string
+	ExpireAt int64  `json:",omitempty"` // unix nano
+	Version  uint64 `json:",omitempty"` // raft index of last set, zero if set before versions
+}
+
+func (e *cacheEntry) expired(now time.Time) bool {
+	return e.expiredAt(now.UnixNano())
+}
+
+func (e *cacheEntry) expiredAt(now int64) bool {
+	return e.ExpireAt != 0 && e.ExpireAt <= now
+}
+
 func NewCacheManager() *cacheManager {
 	return &cacheManager{m: sync.Map{}}
 }
 
+// Get - value of key, expired one is hidden before reaper deletes it
 func (cm *cacheManager) Get(key string) (val string, found bool) {
-	v, ok := cm.m.Load(key)
-	log.Println(key, v, ok)
+	e, ok := cm.lookup(key, time.Now().UnixNano())
+	log.Println(key, e, ok)
 	if !ok {
 		return
 	}
 
-	val, found = v.(string)
-	return
+	return e.Value, true
 }
 
-func (cm *cacheManager) Set(key, val string) {
-	cm.m.Store(key, val)
+// lookup - entry of key not expired at now, unix nano. expiry is not checked if now is zero
+func (cm *cacheManager) lookup(key string, now int64) (*cacheEntry, bool) {
+	v, ok := cm.m.Load(key)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(*cacheEntry)
+	if now != 0 && e.expiredAt(now) {
+		return nil, false
+	}
+
+	return e, true
+}
+
+// matches - whether key is of version prev at now, which is decided by leader.
+// unconditional if prev is nil, and key must be absent if *prev is zero.
+// version is current one of key, zero if absent
+func (cm *cacheManager) matches(key string, prev *uint64, now int64) (version uint64, ok bool) {
+	e, found := cm.lookup(key, now)
+	if found {
+		version = e.Version
+	}
+
+	switch {
+	case prev == nil:
+		return version, true
+	case *prev == 0:
+		return version, !found
+	default:
+		return version, found && e.Version == *prev
+	}
+}
+
+// Set - set value of key at raft index, expireAt is unix nano, zero if never expires
+func (cm *cacheManager) Set(key, val string, expireAt int64, index uint64) {
+	cm.m.Store(key, &cacheEntry{Value: val, ExpireAt: expireAt, Version: index})
+}
+
+// Delete - remove key, whether it existed
+func (cm *cacheManager) Delete(key string) bool {
+	_, ok := cm.m.Load(key)
+	cm.m.Delete(key)
+	return ok
+}
+
+// Expire - remove key if it is still of deadline expireAt, not set again since
+func (cm *cacheManager) Expire(key string, expireAt int64) bool {
+	v, ok := cm.m.Load(key)
+	if !ok || v.(*cacheEntry).ExpireAt != expireAt {
+		return false
+	}
+
+	cm.m.Delete(key)
+	return true
+}
+
+// expired - keys expired at now, at most limit
+func (cm *cacheManager) expired(now time.Time, limit int) []expireData {
+	var keys []expireData
+	cm.m.Range(func(key, value interface{}) bool {
+		if e := value.(*cacheEntry); e.expired(now) {
+			keys = append(keys, expireData{Key: key.(string), ExpireAt: e.ExpireAt})
+		}
+
+		return len(keys) < limit
+	})
+
+	return keys
 }
 
 func (cm *cacheManager) Marshal() ([]byte, error) {
-	var m = make(map[string]interface{})
+	var m = make(map[string]*cacheEntry)
 
 	cm.m.Range(func(key, value interface{}) bool {
 		k := key.(string)
 		log.Println("marshall", key, value)
-		m[k] = value
+		m[k] = value.(*cacheEntry)
 
 		return true
 	})
@@ -44,17 +126,24 @@ func (cm *cacheManager) Marshal() ([]byte, error) {
 	return json.Marshal(m)
 }
 
-func (cm *cacheManager) UnMarshal(serialized io.ReadCloser) error {
+// UnMarshal - restore snapshot, values of snapshot taken by old version are plain strings
+func (cm *cacheManager) UnMarshal(serialized []byte) error {
 	log.Println("unmarshall")
-	var newData map[string]string
-	if err := json.NewDecoder(serialized).Decode(&newData); err != nil {
+	var newData map[string]json.RawMessage
+	if err := json.Unmarshal(serialized, &newData); err != nil {
 		return err
 	}
 
 	cm.m = sync.Map{}
 	for key, value := range newData {
-		log.Println(key, value)
-		cm.m.Store(key, value)
+		log.Println(key, string(value))
+		e := new(cacheEntry)
+		if err := json.Unmarshal(value, &e.Value); err != nil {
+			if err = json.Unmarshal(value, e); err != nil {
+				return err
+			}
+		}
+		cm.m.Store(key, e)
 	}
 
 	return nil
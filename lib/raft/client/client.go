@@ -0,0 +1,466 @@
+// Package client talks to raft cache servers, tracking the leader and retrying on leader change.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Consistency - read consistency level
+type Consistency string
+
+const (
+	// Stale - read from any node, value may be stale on followers
+	Stale Consistency = "stale"
+	// Leader - read from leader after it verified leadership
+	Leader Consistency = "leader"
+	// Linearizable - read from leader after all writes committed before the read are applied
+	Linearizable Consistency = "linearizable"
+)
+
+const (
+	versionHeader = "X-Cache-Version"
+	indexHeader   = "X-Cache-Index"
+	leaderHeader  = "X-Cache-Leader"
+
+	defaultTimeout   = 5 * time.Second
+	defaultRetries   = 3
+	defaultRetryWait = 100 * time.Millisecond
+)
+
+var (
+	// ErrNotFound - key does not exist or expired
+	ErrNotFound = errors.New("client: key not found")
+	// ErrNotLeader - no leader could be reached, or leader changed on every retry
+	ErrNotLeader = errors.New("client: no leader")
+	// ErrTimeout - Config.Timeout or deadline of context passed before response,
+	// context canceled by caller is returned as it is
+	ErrTimeout = errors.New("client: timeout")
+	// ErrConflict - version given does not match version of key
+	ErrConflict = errors.New("client: version mismatch")
+	// ErrUnknownResult - write was sent but failed before its result is known, it may be applied.
+	// returned wrapped in *UnknownResultError, test it by errors.Is
+	ErrUnknownResult = errors.New("client: write result unknown")
+)
+
+// StatusError - unexpected response of server
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("client: status %d: %s", e.Code, e.Body)
+}
+
+// UnknownResultError - write failed after it was sent to Node, it is not retried
+// as it may have been applied
+type UnknownResultError struct {
+	Method string
+	Path   string
+	Node   string
+	Err    error // transport error, or *StatusError of leader lost leadership during write
+}
+
+func (e *UnknownResultError) Error() string {
+	return fmt.Sprintf("client: %s %s on %s, result unknown: %v", e.Method, e.Path, e.Node, e.Err)
+}
+
+// Is - matches ErrUnknownResult
+func (e *UnknownResultError) Is(target error) bool {
+	return target == ErrUnknownResult
+}
+
+func (e *UnknownResultError) Unwrap() error {
+	return e.Err
+}
+
+// Config - client config
+type Config struct {
+	Nodes []string // http addresses of seed nodes, other nodes are discovered from them
+
+	Timeout    time.Duration // of a call including retries if context has no deadline. 5s if zero
+	Retries    int           // max retries on leader change or node unreachable. 3 if zero, writes sent are never retried
+	RetryWait  time.Duration // wait before retry. 100ms if zero
+	HTTPClient *http.Client  // http.DefaultClient if nil, redirects are never followed
+}
+
+// Item - value of key and where it was read
+type Item struct {
+	Value   string
+	Version uint64 // raft index key was last set at
+	Index   uint64 // raft index the node read reflects
+}
+
+// SetOptions - options of Set
+type SetOptions struct {
+	TTL     time.Duration // key expires after TTL if not zero
+	Version *uint64       // set only if version of key is *Version, 0 means key must be absent
+}
+
+// Client - safe for concurrent use
+type Client struct {
+	conf *Config
+	http *http.Client
+
+	lock   sync.Mutex
+	nodes  []string
+	next   int
+	leader string // http address of leader, empty if unknown
+}
+
+// New - client of conf, leader is discovered lazily
+func New(conf *Config) (*Client, error) {
+	c := *conf
+	if len(c.Nodes) == 0 {
+		return nil, errors.New("client: no node")
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Retries <= 0 {
+		c.Retries = defaultRetries
+	}
+	if c.RetryWait <= 0 {
+		c.RetryWait = defaultRetryWait
+	}
+
+	hc := http.DefaultClient
+	if c.HTTPClient != nil {
+		hc = c.HTTPClient
+	}
+	// redirect of follower tells the leader, it is followed by retry
+	noRedirect := *hc
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &Client{
+		conf:  &c,
+		http:  &noRedirect,
+		nodes: append([]string(nil), c.Nodes...),
+	}, nil
+}
+
+// Get - value of key read at level, ErrNotFound if key does not exist
+func (c *Client) Get(ctx context.Context, key string, level Consistency) (*Item, error) {
+	q := url.Values{"key": {key}}
+	if level != "" {
+		q.Set("consistency", string(level))
+	}
+
+	code, header, body, err := c.do(ctx, level != "" && level != Stale, http.MethodGet, "/get", q)
+	if err != nil {
+		return nil, err
+	}
+
+	switch code {
+	case http.StatusOK:
+		item := &Item{Value: string(body)}
+		item.Version, _ = strconv.ParseUint(header.Get(versionHeader), 10, 64)
+		item.Index, _ = strconv.ParseUint(header.Get(indexHeader), 10, 64)
+		return item, nil
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, &StatusError{Code: code, Body: string(body)}
+	}
+}
+
+// Set - set key to value, returns version of key. ErrConflict and current version
+// are returned if opts.Version does not match
+func (c *Client) Set(ctx context.Context, key, value string, opts *SetOptions) (uint64, error) {
+	q := url.Values{"key": {key}, "value": {value}}
+	if opts != nil {
+		if opts.TTL > 0 {
+			q.Set("ttl", opts.TTL.String())
+		}
+		if opts.Version != nil {
+			q.Set("version", strconv.FormatUint(*opts.Version, 10))
+		}
+	}
+
+	code, header, body, err := c.do(ctx, true, http.MethodPost, "/set", q)
+	if err != nil {
+		return 0, err
+	}
+
+	version, _ := strconv.ParseUint(header.Get(versionHeader), 10, 64)
+	switch code {
+	case http.StatusOK:
+		return version, nil
+	case http.StatusConflict:
+		return version, ErrConflict
+	default:
+		return 0, &StatusError{Code: code, Body: string(body)}
+	}
+}
+
+// Delete - delete key, only if its version is *version when version is not nil.
+// ErrNotFound if key does not exist
+func (c *Client) Delete(ctx context.Context, key string, version *uint64) error {
+	q := url.Values{"key": {key}}
+	if version != nil {
+		q.Set("version", strconv.FormatUint(*version, 10))
+	}
+
+	code, _, body, err := c.do(ctx, true, http.MethodDelete, "/key", q)
+	if err != nil {
+		return err
+	}
+
+	switch code {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	default:
+		return &StatusError{Code: code, Body: string(body)}
+	}
+}
+
+// Leader - http address of leader, discovered if unknown
+func (c *Client) Leader(ctx context.Context) (string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if leader := c.getLeader(); leader != "" {
+		return leader, nil
+	}
+
+	leader, err := c.discover(ctx)
+	if err != nil && ctx.Err() != nil {
+		return "", ctxErr(ctx)
+	}
+
+	return leader, err
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, c.conf.Timeout)
+}
+
+// ctxErr - ErrTimeout once deadline passed, context.Canceled if caller canceled
+func ctxErr(ctx context.Context) error {
+	if err := ctx.Err(); err != context.DeadlineExceeded {
+		return err
+	}
+
+	return ErrTimeout
+}
+
+// do - send request to leader if toLeader, or to any node. retried on another node or leader
+// if node is unreachable, has no leader, or redirects to leader. write failed after it was sent
+// may have been applied, *UnknownResultError is returned instead of retry
+func (c *Client) do(ctx context.Context, toLeader bool, method, path string, q url.Values) (int, http.Header, []byte, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	err := ErrNotLeader
+	redirects, wait := 0, false
+	for i := 0; i <= c.conf.Retries; i++ {
+		if wait {
+			select {
+			case <-ctx.Done():
+				return 0, nil, nil, ctxErr(ctx)
+			case <-time.After(c.conf.RetryWait):
+			}
+		}
+		wait = true
+
+		node := c.pick()
+		if toLeader {
+			if node = c.getLeader(); node == "" {
+				if node, err = c.discover(ctx); err != nil {
+					continue
+				}
+			}
+		}
+
+		var code int
+		var header http.Header
+		var body []byte
+		code, header, body, err = c.send(ctx, method, node, path, q)
+		if ctx.Err() != nil {
+			return 0, nil, nil, ctxErr(ctx)
+		}
+		write := method != http.MethodGet
+		if err != nil {
+			c.unreachable(node)
+			if write && !notSent(err) {
+				return 0, nil, nil, &UnknownResultError{Method: method, Path: path, Node: node, Err: err}
+			}
+			continue
+		}
+
+		switch code {
+		case http.StatusTemporaryRedirect:
+			if u, perr := url.Parse(header.Get("Location")); perr == nil && u.Host != "" {
+				// followed at once, not counted as retry unless redirected again and again
+				c.setLeader(u.Host)
+				if redirects++; redirects <= c.conf.Retries {
+					i, wait = i-1, false
+				}
+				continue
+			}
+			return code, header, body, nil
+		case http.StatusServiceUnavailable:
+			// no leader, leader stepped down or node shutting down, write is not applied.
+			// new leader is told if known
+			c.setLeader(header.Get(leaderHeader))
+			err = ErrNotLeader
+			continue
+		case http.StatusInternalServerError:
+			if write {
+				// like leadership lost after write was appended
+				return 0, nil, nil, &UnknownResultError{Method: method, Path: path, Node: node, Err: &StatusError{Code: code, Body: string(body)}}
+			}
+		}
+
+		if leader := header.Get(leaderHeader); leader != "" {
+			c.setLeader(leader)
+		}
+		return code, header, body, nil
+	}
+
+	if err != ErrNotLeader {
+		err = fmt.Errorf("client: %s %s failed after %d retries: %v", method, path, c.conf.Retries, err)
+	}
+	return 0, nil, nil, err
+}
+
+func (c *Client) send(ctx context.Context, method, node, path string, q url.Values) (int, http.Header, []byte, error) {
+	u := url.URL{Scheme: "http", Host: node, Path: path, RawQuery: q.Encode()}
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	return resp.StatusCode, resp.Header, body, nil
+}
+
+// notSent - request failed before it was sent, node could not be dialed or refused connection
+func notSent(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+
+	operr, ok := err.(*net.OpError)
+	return ok && operr.Op == "dial"
+}
+
+// member - of GET /members
+type member struct {
+	HTTPAddr string `json:"httpAddr"`
+	State    string `json:"state"`
+}
+
+// discover - ask nodes for members, nodes learned are tracked as well
+func (c *Client) discover(ctx context.Context) (string, error) {
+	c.lock.Lock()
+	nodes := append([]string(nil), c.nodes...)
+	c.lock.Unlock()
+
+	for _, node := range nodes {
+		code, _, body, err := c.send(ctx, http.MethodGet, node, "/members", nil)
+		if err != nil || code != http.StatusOK {
+			continue
+		}
+
+		var members []member
+		if json.Unmarshal(body, &members) != nil {
+			continue
+		}
+
+		var leader string
+		for _, m := range members {
+			if m.HTTPAddr == "" {
+				continue
+			}
+			c.addNode(m.HTTPAddr)
+			if m.State == "Leader" {
+				leader = m.HTTPAddr
+			}
+		}
+
+		if leader != "" {
+			c.setLeader(leader)
+			return leader, nil
+		}
+	}
+
+	return "", ErrNotLeader
+}
+
+// pick - nodes in turn
+func (c *Client) pick() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	node := c.nodes[c.next%len(c.nodes)]
+	c.next++
+	return node
+}
+
+func (c *Client) getLeader() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.leader
+}
+
+func (c *Client) setLeader(leader string) {
+	c.lock.Lock()
+	c.leader = leader
+	c.lock.Unlock()
+	if leader != "" {
+		c.addNode(leader)
+	}
+}
+
+func (c *Client) addNode(node string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, n := range c.nodes {
+		if n == node {
+			return
+		}
+	}
+	c.nodes = append(c.nodes, node)
+}
+
+// unreachable - forget leader if it can not be reached, node is still tried later
+func (c *Client) unreachable(node string) {
+	c.lock.Lock()
+	if c.leader == node {
+		c.leader = ""
+	}
+	c.lock.Unlock()
+}
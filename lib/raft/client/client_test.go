@@ -0,0 +1,247 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yusank/klyn-log/lib/raft"
+)
+
+// startCluster - servers on random ports, first one bootstraps cluster and others join it
+func startCluster(t *testing.T, dir string, n int) []*raft.Server {
+	t.Helper()
+	var servers []*raft.Server
+	for i := 0; i < n; i++ {
+		cfg := &raft.Config{
+			DataDir:            filepath.Join(dir, fmt.Sprintf("node%d", i+1)),
+			HTTPAddr:           "127.0.0.1:0",
+			RaftAddr:           "127.0.0.1:0",
+			Bootstrap:          i == 0,
+			TransferLeadership: true,
+		}
+		if i > 0 {
+			cfg.JoinAddr = servers[0].HTTPAddr()
+		}
+
+		s, err := raft.NewServer(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		servers = append(servers, s)
+
+		// wait for leader before others join
+		if i == 0 {
+			c, _ := New(&Config{Nodes: []string{s.HTTPAddr()}, Timeout: 10 * time.Second, Retries: 100})
+			if _, err = c.Set(context.Background(), "ready", "1", nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	return servers
+}
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	servers := startCluster(t, dir, 3)
+	for _, s := range servers {
+		defer s.Shutdown(context.Background())
+	}
+
+	// seed is a follower, leader is discovered
+	c, err := New(&Config{Nodes: []string{servers[2].HTTPAddr()}, Timeout: 10 * time.Second, Retries: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	version, err := c.Set(ctx, "a", "1", nil)
+	if err != nil || version == 0 {
+		t.Fatalf("set failed: %d %v", version, err)
+	}
+	if leader, _ := c.Leader(ctx); leader != servers[0].HTTPAddr() {
+		t.Fatalf("want leader %s, got %s", servers[0].HTTPAddr(), leader)
+	}
+
+	item, err := c.Get(ctx, "a", Linearizable)
+	if err != nil || item.Value != "1" || item.Version != version || item.Index < version {
+		t.Fatalf("unexpected item %+v %v", item, err)
+	}
+
+	wrong := version + 100
+	if current, err := c.Set(ctx, "a", "2", &SetOptions{Version: &wrong}); err != ErrConflict || current != version {
+		t.Fatalf("want conflict at version %d, got %d %v", version, current, err)
+	}
+	if _, err = c.Set(ctx, "a", "2", &SetOptions{Version: &version, TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Delete(ctx, "a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Delete(ctx, "a", nil); err != ErrNotFound {
+		t.Fatalf("want not found, got %v", err)
+	}
+	if _, err = c.Get(ctx, "a", Leader); err != ErrNotFound {
+		t.Fatalf("want not found, got %v", err)
+	}
+
+	// leader is gone, client follows the new one
+	if err = servers[0].Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Set(ctx, "b", "2", nil); err != nil {
+		t.Fatalf("set after leader change failed: %v", err)
+	}
+	if leader, _ := c.Leader(ctx); leader == servers[0].HTTPAddr() {
+		t.Fatal("want new leader")
+	}
+	if item, err = c.Get(ctx, "b", Linearizable); err != nil || item.Value != "2" {
+		t.Fatalf("unexpected item %+v %v", item, err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, time.Nanosecond)
+	defer cancel()
+	if _, err = c.Get(timeout, "b", Stale); err != ErrTimeout {
+		t.Fatalf("want timeout, got %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = c.Get(canceled, "b", Stale); err != context.Canceled {
+		t.Fatalf("want canceled, got %v", err)
+	}
+}
+
+func TestClientNoLeader(t *testing.T) {
+	if _, err := New(&Config{}); err == nil {
+		t.Fatal("want error without node")
+	}
+
+	c, err := New(&Config{Nodes: []string{"127.0.0.1:1"}, Retries: 1, RetryWait: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Set(context.Background(), "a", "1", nil); err != ErrNotLeader {
+		t.Fatalf("want no leader, got %v", err)
+	}
+}
+
+func TestClientWriteNotRetried(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	servers := startCluster(t, dir, 1)
+	defer servers[0].Shutdown(context.Background())
+
+	// proxy taken as leader, write is applied by server but response is dropped
+	var sent int32
+	var proxy *httptest.Server
+	proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/members" {
+			fmt.Fprintf(w, `[{"httpAddr":%q,"state":"Leader"}]`, proxy.Listener.Addr().String())
+			return
+		}
+
+		atomic.AddInt32(&sent, 1)
+		req, _ := http.NewRequest(r.Method, "http://"+servers[0].HTTPAddr()+r.URL.RequestURI(), nil)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer proxy.Close()
+
+	c, err := New(&Config{Nodes: []string{proxy.Listener.Addr().String()}, Retries: 3, RetryWait: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// retry would fail as key exists
+	absent := uint64(0)
+	if _, err = c.Set(ctx, "a", "1", &SetOptions{Version: &absent}); !errors.Is(err, ErrUnknownResult) {
+		t.Fatalf("want unknown result of dropped response, got %v", err)
+	}
+	if n := atomic.LoadInt32(&sent); n != 1 {
+		t.Fatalf("want write sent once, got %d", n)
+	}
+
+	direct, _ := New(&Config{Nodes: []string{servers[0].HTTPAddr()}})
+	if item, err := direct.Get(ctx, "a", Linearizable); err != nil || item.Value != "1" {
+		t.Fatalf("want write applied, got %+v %v", item, err)
+	}
+}
+
+func TestClientLeaderStepDown(t *testing.T) {
+	// leader stepped down before write was appended, then write goes to new one
+	var sets int32
+	var leader *httptest.Server
+	leader = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sets, 1)
+		w.Header().Set(versionHeader, "7")
+		w.Write([]byte("ok"))
+	}))
+	defer leader.Close()
+
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/members" {
+			fmt.Fprintf(w, `[{"httpAddr":%q,"state":"Leader"}]`, r.Host)
+			return
+		}
+		w.Header().Set(leaderHeader, leader.Listener.Addr().String())
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("not leader"))
+	}))
+	defer old.Close()
+
+	c, err := New(&Config{Nodes: []string{old.Listener.Addr().String()}, RetryWait: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := c.Set(context.Background(), "a", "1", nil); err != nil || version != 7 {
+		t.Fatalf("want write retried on new leader, got %d %v", version, err)
+	}
+	if n := atomic.LoadInt32(&sets); n != 1 {
+		t.Fatalf("want write applied once, got %d", n)
+	}
+
+	// leadership lost after write was appended
+	lost := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/members" {
+			fmt.Fprintf(w, `[{"httpAddr":%q,"state":"Leader"}]`, r.Host)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer lost.Close()
+
+	c, _ = New(&Config{Nodes: []string{lost.Listener.Addr().String()}, RetryWait: time.Millisecond})
+	if _, err = c.Set(context.Background(), "a", "1", nil); !errors.Is(err, ErrUnknownResult) {
+		t.Fatalf("want unknown result, got %v", err)
+	}
+}
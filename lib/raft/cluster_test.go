@@ -0,0 +1,445 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// testNode - node of testCluster, raft log, stable and snapshot stores survive kill and restart
+type testNode struct {
+	id       string // raft address
+	httpAddr string
+	dir      string // DataDir, only of cluster on disk
+
+	store *raft.InmemStore
+	snaps *raft.InmemSnapshotStore
+	trans *raft.InmemTransport
+
+	server *Server
+	up     bool
+}
+
+func (n *testNode) rs() *raftService {
+	return n.server.rs
+}
+
+// testCluster - nodes in one process on in memory transport, http api on loopback.
+// nodes run on tcp transport and bolt stores under dir if set, not to be partitioned
+type testCluster struct {
+	t     *testing.T
+	dir   string
+	nodes []*testNode
+}
+
+// newTestCluster - cluster bootstrapped by node 0, others joined by http, leader elected
+func newTestCluster(t *testing.T, n int) *testCluster {
+	t.Helper()
+	c := &testCluster{t: t}
+	for i := 0; i < n; i++ {
+		c.add(i == 0)
+	}
+
+	c.waitLeader()
+	return c
+}
+
+// add - start a new node, joined to leader by http unless bootstrap
+func (c *testCluster) add(bootstrap bool) *testNode {
+	c.t.Helper()
+	cfg := Config{Bootstrap: bootstrap}
+	if !bootstrap {
+		cfg.JoinAddr = c.waitLeader().httpAddr
+	}
+
+	return c.addConfig(cfg)
+}
+
+// addConfig - start a new node of cfg, neither bootstrapped nor joined if cfg does not say so
+func (c *testCluster) addConfig(cfg Config) *testNode {
+	c.t.Helper()
+	n := &testNode{httpAddr: "127.0.0.1:0"}
+	if c.dir != "" {
+		n.id = "127.0.0.1:0"
+		n.dir = filepath.Join(c.dir, fmt.Sprintf("node%d", len(c.nodes)))
+	} else {
+		n.id = string(raft.NewInmemAddr())
+		n.store = raft.NewInmemStore()
+		n.snaps = raft.NewInmemSnapshotStore()
+	}
+
+	c.nodes = append(c.nodes, n)
+	c.start(n, &cfg)
+
+	return n
+}
+
+// start - start node through Server on its stores and a new in memory transport,
+// or on tcp transport and stores under its dir
+func (c *testCluster) start(n *testNode, cfg *Config) {
+	c.t.Helper()
+	cfg.HTTPAddr = n.httpAddr
+	cfg.RaftAddr = n.id
+	if n.dir != "" {
+		cfg.DataDir = n.dir
+		c.serve(n, cfg)
+		return
+	}
+
+	cfg.DataDir = "memory"
+	_, n.trans = raft.NewInmemTransport(raft.ServerAddress(n.id))
+	cfg.deps = &raftDeps{
+		trans:  n.trans,
+		logs:   n.store,
+		stable: n.store,
+		snaps:  n.snaps,
+		config: func(conf *raft.Config) {
+			conf.LogOutput = ioutil.Discard
+			conf.HeartbeatTimeout = 50 * time.Millisecond
+			conf.ElectionTimeout = 50 * time.Millisecond
+			conf.LeaderLeaseTimeout = 50 * time.Millisecond
+			conf.CommitTimeout = 5 * time.Millisecond
+			// logs are compacted soon, so new and restarted nodes install snapshot
+			conf.TrailingLogs = 4
+		},
+	}
+
+	c.serve(n, cfg)
+}
+
+func (c *testCluster) serve(n *testNode, cfg *Config) {
+	c.t.Helper()
+	s, err := NewServer(cfg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	n.server = s
+
+	// connected before start, join waits for new node to take configuration change
+	n.up = true
+	c.connect()
+	if err = s.Start(); err != nil {
+		c.t.Fatal(err)
+	}
+	// restarted on the same addresses, they are random ports at first on disk
+	n.httpAddr, n.id = s.HTTPAddr(), s.RaftAddr()
+}
+
+// connect - connect transports of all nodes up, partitions are healed
+func (c *testCluster) connect() {
+	if c.dir != "" {
+		return
+	}
+
+	for _, a := range c.nodes {
+		if !a.up {
+			continue
+		}
+		for _, b := range c.nodes {
+			if b.up && a != b {
+				a.trans.Connect(raft.ServerAddress(b.id), b.trans)
+			}
+		}
+	}
+}
+
+// partition - node can not reach others, nor can they reach it
+func (c *testCluster) partition(n *testNode) {
+	for _, o := range c.nodes {
+		if o != n && o.up {
+			n.trans.Disconnect(raft.ServerAddress(o.id))
+			o.trans.Disconnect(raft.ServerAddress(n.id))
+		}
+	}
+}
+
+// kill - shutdown node without leadership transfer, stores are kept
+func (c *testCluster) kill(n *testNode) {
+	c.t.Helper()
+	if err := n.server.Shutdown(context.Background()); err != nil {
+		c.t.Fatal(err)
+	}
+	n.up = false
+}
+
+// restart - start killed node on the same addresses, state is rebuilt from its stores
+func (c *testCluster) restart(n *testNode) {
+	c.t.Helper()
+	c.start(n, &Config{})
+}
+
+func (c *testCluster) shutdown() {
+	for _, n := range c.nodes {
+		if n.up {
+			c.kill(n)
+		}
+	}
+}
+
+// waitLeader - the only leader among nodes up and connected to majority
+func (c *testCluster) waitLeader() *testNode {
+	c.t.Helper()
+	var leader *testNode
+	waitFor(c.t, "leader elected", func() bool {
+		leader = nil
+		for _, n := range c.nodes {
+			if !n.up || n.rs().node.raft.State() != raft.Leader || !n.rs().hService.enableWriteNode() {
+				continue
+			}
+			// leader partitioned away steps down after lease timeout
+			if n.rs().node.raft.VerifyLeader().Error() != nil {
+				continue
+			}
+			if leader != nil {
+				return false
+			}
+			leader = n
+		}
+		return leader != nil
+	})
+
+	return leader
+}
+
+// waitValue - key has value on every node up, read locally
+func (c *testCluster) waitValue(key, value string) {
+	c.t.Helper()
+	waitFor(c.t, fmt.Sprintf("%s=%s replicated", key, value), func() bool {
+		for _, n := range c.nodes {
+			if !n.up {
+				continue
+			}
+			if v, ok := n.rs().cm.Get(key); !ok || v != value {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (c *testCluster) do(n *testNode, method, uri string) (int, string) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, "http://"+n.httpAddr+uri, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+
+	b, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func (c *testCluster) set(n *testNode, key, value string) {
+	c.t.Helper()
+	if code, body := c.do(n, http.MethodPost, fmt.Sprintf("/set?key=%s&value=%s", key, value)); code != http.StatusOK {
+		c.t.Fatalf("set %s on %s failed: %d %s", key, n.id, code, body)
+	}
+}
+
+func TestClusterJoin(t *testing.T) {
+	c := newTestCluster(t, 3)
+	defer c.shutdown()
+
+	leader := c.waitLeader()
+	c.set(leader, "a", "1")
+	c.waitValue("a", "1")
+
+	members, err := leader.rs().members()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 3 {
+		t.Fatalf("want 3 members, got %+v", members)
+	}
+	for _, m := range members {
+		if m.Suffrage != "Voter" {
+			t.Fatalf("want voters only, got %+v", m)
+		}
+	}
+
+	// http addresses are known to all nodes
+	for _, n := range c.nodes {
+		for _, o := range c.nodes {
+			if addr, _ := n.rs().nodes.HTTPAddr(o.id); addr != o.httpAddr {
+				t.Fatalf("want http address %s of %s on %s, got %q", o.httpAddr, o.id, n.id, addr)
+			}
+		}
+	}
+}
+
+func TestClusterFollowerWrites(t *testing.T) {
+	c := newTestCluster(t, 3)
+	defer c.shutdown()
+
+	leader := c.waitLeader()
+	for _, n := range c.nodes {
+		if n == leader {
+			continue
+		}
+
+		c.set(n, "a", n.id)
+		c.waitValue("a", n.id)
+
+		if code, _ := c.do(n, http.MethodDelete, "/key?key=a"); code != http.StatusOK {
+			t.Fatalf("delete on follower failed: %d", code)
+		}
+		if code, v := c.do(n, http.MethodGet, "/get?key=a&consistency=linearizable"); code != http.StatusNotFound {
+			t.Fatalf("want a deleted, got %d %s", code, v)
+		}
+	}
+
+	// followers redirect when configured, http client follows it
+	for _, n := range c.nodes {
+		n.rs().hService.forward = forwardRedirect
+	}
+	for _, n := range c.nodes {
+		if n != leader {
+			c.set(n, "b", "2")
+		}
+	}
+	c.waitValue("b", "2")
+}
+
+func TestClusterFailover(t *testing.T) {
+	c := newTestCluster(t, 3)
+	defer c.shutdown()
+
+	old := c.waitLeader()
+	c.set(old, "a", "1")
+	c.waitValue("a", "1")
+
+	c.kill(old)
+	leader := c.waitLeader()
+	if leader == old {
+		t.Fatal("want new leader")
+	}
+	// write acknowledged by old leader is read by new one
+	if code, v := c.do(leader, http.MethodGet, "/get?key=a&consistency=linearizable"); code != http.StatusOK || v != "1" {
+		t.Fatalf("want a=1 read on new leader, got %d %s", code, v)
+	}
+	c.set(leader, "a", "2")
+	c.waitValue("a", "2")
+
+	// old leader catches up as follower
+	c.restart(old)
+	c.waitValue("a", "2")
+	if c.waitLeader() == old {
+		t.Fatal("want restarted node follower")
+	}
+}
+
+func TestClusterPartition(t *testing.T) {
+	c := newTestCluster(t, 3)
+	defer c.shutdown()
+
+	old := c.waitLeader()
+	c.set(old, "a", "1")
+	c.waitValue("a", "1")
+
+	c.partition(old)
+	// minority can not commit, leader steps down after lease timeout
+	waitFor(t, "old leader stepped down", func() bool {
+		return old.rs().node.raft.State() != raft.Leader
+	})
+	leader := c.waitLeader()
+	if leader == old {
+		t.Fatal("want new leader of majority")
+	}
+	c.set(leader, "a", "2")
+
+	if code, _ := c.do(old, http.MethodPost, "/set?key=a&value=3"); code == http.StatusOK {
+		t.Fatal("want write on minority failed")
+	}
+	if v, _ := old.rs().cm.Get("a"); v != "1" {
+		t.Fatalf("want stale a=1 on minority, got %q", v)
+	}
+
+	c.connect()
+	c.waitValue("a", "2")
+}
+
+func TestClusterSnapshotRestore(t *testing.T) {
+	c := newTestCluster(t, 3)
+	defer c.shutdown()
+
+	leader := c.waitLeader()
+	for i := 0; i < 20; i++ {
+		c.set(leader, fmt.Sprintf("k%d", i), fmt.Sprint(i))
+	}
+	if code, body := c.do(leader, http.MethodPost, "/set?key=ttl&value=1&ttl=1h"); code != http.StatusOK {
+		t.Fatalf("set ttl failed: %d %s", code, body)
+	}
+	c.waitValue("k19", "19")
+
+	for _, n := range c.nodes {
+		if err := n.rs().node.raft.Snapshot().Error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// logs are compacted, new node installs snapshot of leader
+	joined := c.add(false)
+	c.waitValue("k0", "0")
+	c.waitValue("k19", "19")
+	if v, ok := joined.rs().cm.m.Load("ttl"); !ok || v.(*cacheEntry).ExpireAt == 0 {
+		t.Fatalf("want ttl restored, got %v", v)
+	}
+	if addr, _ := joined.rs().nodes.HTTPAddr(leader.id); addr != leader.httpAddr {
+		t.Fatalf("want http address of leader restored, got %q", addr)
+	}
+
+	// restarted follower restores its own snapshot
+	var follower *testNode
+	for _, n := range c.nodes {
+		if n != leader && n != joined {
+			follower = n
+		}
+	}
+	c.kill(follower)
+	c.set(leader, "k0", "changed")
+	c.restart(follower)
+	c.waitValue("k0", "changed")
+	c.waitValue("k19", "19")
+	if follower.rs().node.fsm.AppliedIndex() == 0 {
+		t.Fatal("want applied index restored")
+	}
+}
+
+func TestClusterRemoveLeader(t *testing.T) {
+	c := newTestCluster(t, 3)
+	defer c.shutdown()
+
+	old := c.waitLeader()
+	if code, body := c.do(old, http.MethodPost, "/remove?id="+old.id); code != http.StatusOK {
+		t.Fatalf("remove leader failed: %d %s", code, body)
+	}
+	// removed node is left out of checks below
+	c.kill(old)
+
+	leader := c.waitLeader()
+	if leader == old {
+		t.Fatal("want new leader")
+	}
+	c.set(leader, "a", "1")
+	c.waitValue("a", "1")
+
+	for _, n := range c.nodes {
+		if !n.up {
+			continue
+		}
+		if addr, ok := n.rs().nodes.HTTPAddr(old.id); ok {
+			t.Fatalf("want http address of removed leader deleted on %s, got %q", n.id, addr)
+		}
+	}
+}
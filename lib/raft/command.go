@@ -0,0 +1,91 @@
+package raft
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// command: raft 日志中的命令, Op 决定 Data 的类型
+type command struct {
+	Op   commandOp       `json:"op"`
+	Data json.RawMessage `json:"data"`
+}
+
+type commandOp string
+
+const (
+	opSet    commandOp = "set"
+	opDelete commandOp = "delete"
+	opExpire commandOp = "expire"
+	opNode   commandOp = "node"
+)
+
+// logEntryData - data of opSet, also the whole entry written before commands had Op
+type logEntryData struct {
+	Key      string
+	Value    string
+	ExpireAt int64 `json:",omitempty"` // unix nano decided by leader, never expires if zero
+
+	condition
+}
+
+type deleteData struct {
+	Key string
+
+	condition
+}
+
+// condition - command takes effect only if key is of PrevVersion at Now
+type condition struct {
+	PrevVersion *uint64 `json:",omitempty"` // unconditional if nil, key must be absent if zero
+	Now         int64   `json:",omitempty"` // unix nano of leader, keys expired at it are absent
+}
+
+// nodeData - data of opNode, http address a node serves at, node removed if HTTPAddr is empty
+type nodeData struct {
+	RaftAddr string
+	HTTPAddr string
+}
+
+// applyResult - response of FSM.Apply
+type applyResult struct {
+	Applied bool   // condition held and key was changed
+	Version uint64 // version of key after command, or current one if condition failed. zero if absent
+}
+
+// expireData - data of opExpire, key is deleted only if it is still of ExpireAt
+type expireData struct {
+	Key      string
+	ExpireAt int64
+}
+
+func newCommand(op commandOp, data interface{}) ([]byte, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(command{Op: op, Data: b})
+}
+
+// decodeCommand - entries of old version are logEntryData without op, taken as set
+func decodeCommand(b []byte) (*command, error) {
+	c := new(command)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+
+	if c.Op == "" {
+		c.Op, c.Data = opSet, b
+	}
+
+	return c, nil
+}
+
+func (c *command) decodeData(v interface{}) error {
+	if err := json.Unmarshal(c.Data, v); err != nil {
+		return fmt.Errorf("invalid %s command: %v", c.Op, err)
+	}
+
+	return nil
+}
@@ -1,30 +1,55 @@
 package raft
 
-import "flag"
-
-// 节点信息
-type config struct {
-	dataDir       string
-	httpAddr      string
-	raftTCPAddr   string
-	startAsLeader bool
-	joinAddr      string
+import (
+	"errors"
+	"fmt"
+)
+
+// Config - 节点配置
+type Config struct {
+	DataDir  string // raft 日志和快照目录
+	HTTPAddr string // http api 地址, 端口为 0 时随机分配
+	RaftAddr string // raft tcp 地址, 也是节点 id, 端口为 0 时随机分配
+
+	Bootstrap bool   // 以单节点集群启动, 成为 leader
+	JoinAddr  string // 加入集群时, 集群中任一节点的 http 地址
+	Nonvoter  bool   // 以 learner 加入集群, 不参与投票
+	Forward   string // 非 leader 节点如何转发写请求: proxy 或 redirect
+
+	// TransferLeadership - leader 关闭前把 leadership 转移给其他节点, 不必等选举超时
+	TransferLeadership bool
+
+	deps *raftDeps // 测试用, 不为 nil 时不打开 tcp transport 和 DataDir 下的 store
 }
 
-func NewConfig() *config {
-	var conf = &config{}
-	var httpAddress = flag.String("http", "127.0.0.1:6000", "Http address")
-	var raftTCPAddress = flag.String("raft", "127.0.0.1:7000", "raft tcp address")
-	var node = flag.String("node", "node1", "raft node name")
-	var isLeader = flag.Bool("leader", false, "start as raft cluster")
-	var joinAddress = flag.String("join", "", "join address for raft cluster")
-	flag.Parse()
-
-	conf.dataDir = "./" + *node
-	conf.httpAddr = *httpAddress
-	conf.startAsLeader = *isLeader
-	conf.raftTCPAddr = *raftTCPAddress
-	conf.joinAddr = *joinAddress
-
-	return conf
+// DefaultConfig - config of node1 on localhost
+func DefaultConfig() *Config {
+	return &Config{
+		DataDir:  "./node1",
+		HTTPAddr: "127.0.0.1:6000",
+		RaftAddr: "127.0.0.1:7000",
+		Forward:  forwardProxy,
+	}
+}
+
+func (c *Config) validate() error {
+	if c.DataDir == "" {
+		return errors.New("data dir is empty")
+	}
+	if c.HTTPAddr == "" || c.RaftAddr == "" {
+		return errors.New("http or raft address is empty")
+	}
+	if c.Bootstrap && c.JoinAddr != "" {
+		return errors.New("bootstrap and join are exclusive")
+	}
+
+	switch c.Forward {
+	case "":
+		c.Forward = forwardProxy
+	case forwardProxy, forwardRedirect:
+	default:
+		return fmt.Errorf("unknown forward %q, proxy or redirect", c.Forward)
+	}
+
+	return nil
 }
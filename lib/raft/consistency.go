@@ -0,0 +1,48 @@
+package raft
+
+import (
+	"fmt"
+	"time"
+)
+
+// 读一致性级别
+const (
+	// consistencyStale - 读本地状态, follower 可能返回旧值
+	consistencyStale = "stale"
+	// consistencyLeader - 只在 leader 上读, 读之前确认仍是 leader, 新 leader 可能还未 apply 完已提交的日志
+	consistencyLeader = "leader"
+	// consistencyLinearizable - 经过 raft barrier 再读, 读开始前提交的日志都已 apply
+	consistencyLinearizable = "linearizable"
+)
+
+const (
+	// indexHeader - raft index the state read reflects
+	indexHeader = "X-Cache-Index"
+
+	readTimeout = 5 * time.Second
+)
+
+func validConsistency(level string) bool {
+	switch level {
+	case consistencyStale, consistencyLeader, consistencyLinearizable:
+		return true
+	default:
+		return false
+	}
+}
+
+// readBarrier - wait until local state may be read at consistency level, on leader only unless stale
+func (rs *raftService) readBarrier(level string) error {
+	switch level {
+	case consistencyLeader:
+		return rs.node.raft.VerifyLeader().Error()
+	case consistencyLinearizable:
+		// barrier 在当前 term 提交并且之前的日志都 apply 后返回, 新 leader 也不会读到
+		// 上一个 leader 已提交但还没 apply 的旧值
+		return rs.node.raft.Barrier(readTimeout).Error()
+	case consistencyStale:
+		return nil
+	default:
+		return fmt.Errorf("unknown consistency %q", level)
+	}
+}
@@ -0,0 +1,54 @@
+package raft
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestReadConsistency(t *testing.T) {
+	c := newTestCluster(t, 1)
+	defer c.shutdown()
+	h := c.waitLeader().rs().hService
+
+	w := httptest.NewRecorder()
+	h.mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/set?key=a&value=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("set failed: %d %s", w.Code, w.Body.String())
+	}
+	version := w.Header().Get(versionHeader)
+
+	for _, level := range []string{"", consistencyStale, consistencyLeader, consistencyLinearizable} {
+		w = httptest.NewRecorder()
+		h.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/get?key=a&consistency="+level, nil))
+		if w.Code != http.StatusOK || w.Body.String() != "1" {
+			t.Fatalf("%q: want a=1, got %d %q", level, w.Code, w.Body.String())
+		}
+
+		index, err := strconv.ParseUint(w.Header().Get(indexHeader), 10, 64)
+		if err != nil {
+			t.Fatalf("%q: invalid index header: %v", level, err)
+		}
+		if v, _ := strconv.ParseUint(version, 10, 64); index < v {
+			t.Fatalf("%q: want index not less than version %d, got %d", level, v, index)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/get?key=a&consistency=strong", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("want unknown consistency rejected, got %d", w.Code)
+	}
+}
+
+func TestReadConsistencyOnFollower(t *testing.T) {
+	h := newTestHTTPServer(forwardRedirect, "127.0.0.1:6000")
+	h.ctx.rs.cm.Set("a", "1", 0, 1)
+
+	w := httptest.NewRecorder()
+	h.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/get?key=a&consistency=linearizable", nil))
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "http://127.0.0.1:6000/get?key=a&consistency=linearizable" {
+		t.Fatalf("want read redirected to leader, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+}
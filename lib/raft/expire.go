@@ -0,0 +1,35 @@
+package raft
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// reapInterval - 过期 key 的检查间隔
+	reapInterval = time.Second
+	// reapBatch - 每次最多删除的过期 key
+	reapBatch = 1000
+)
+
+// reap - 只在 leader 上运行, 过期的 key 通过 raft 复制删除, 所有节点最终一致.
+// key 在删除前被重新 set 时 ExpireAt 不同, FSM 不会删除它
+func (rs *raftService) reap(stop <-chan struct{}) {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			for _, d := range rs.cm.expired(now, reapBatch) {
+				if _, err := rs.apply(opExpire, d); err != nil {
+					// leadership lost, next leader takes over
+					log.Printf("expire %s failed:%v", d.Key, err)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package raft
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+const (
+	forwardProxy    = "proxy"
+	forwardRedirect = "redirect"
+
+	// leaderHeader - follower 返回的 leader http 地址
+	leaderHeader = "X-Cache-Leader"
+	// forwardedHeader - 已被 follower 转发的请求, 不再转发, 避免 leader 变更时循环转发
+	forwardedHeader = "X-Cache-Forwarded"
+)
+
+// leaderHTTPAddr - http address of current leader, empty if leader or its address unknown
+func (h *httpServer) leaderHTTPAddr() string {
+	leader := h.ctx.rs.node.raft.Leader()
+	if leader == "" {
+		return ""
+	}
+
+	httpAddr, _ := h.ctx.rs.nodes.HTTPAddr(string(leader))
+	return httpAddr
+}
+
+// writeHandler - 写请求只能在 leader 上执行, follower 把请求代理或重定向到 leader
+func (h *httpServer) writeHandler(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.isClosing() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("shutting down"))
+			return
+		}
+
+		if h.enableWriteNode() {
+			fn(w, r)
+			return
+		}
+
+		h.forwardToLeader(w, r)
+	}
+}
+
+// forwardToLeader - proxy or redirect request to leader, 503 if no leader known
+func (h *httpServer) forwardToLeader(w http.ResponseWriter, r *http.Request) {
+	leader := h.leaderAddr()
+	if leader == "" || r.Header.Get(forwardedHeader) != "" {
+		h.logger.Printf("%s %s: no leader to forward", r.Method, r.RequestURI)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("no leader"))
+		return
+	}
+
+	w.Header().Set(leaderHeader, leader)
+	target := &url.URL{Scheme: "http", Host: leader, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+	if h.forward == forwardRedirect {
+		http.Redirect(w, r, target.String(), http.StatusTemporaryRedirect)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.Header.Set(forwardedHeader, "1")
+		},
+		ErrorLog: h.logger,
+	}
+	proxy.ServeHTTP(w, r)
+}
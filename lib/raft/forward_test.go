@@ -0,0 +1,100 @@
+package raft
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func newTestHTTPServer(forward, leader string) *httpServer {
+	rs := &raftService{cfg: &Config{Forward: forward}, cm: NewCacheManager(), nodes: new(nodeRegistry)}
+	h := newHttpServer(&raftContext{rs: rs}, log.New(ioutil.Discard, "", 0))
+	h.leaderAddr = func() string { return leader }
+	return h
+}
+
+func TestForwardProxy(t *testing.T) {
+	var forwarded string
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(forwardedHeader)
+		w.Write([]byte(r.Method + " " + r.URL.RequestURI()))
+	}))
+	defer leader.Close()
+
+	leaderAddr := strings.TrimPrefix(leader.URL, "http://")
+	h := newTestHTTPServer(forwardProxy, leaderAddr)
+
+	w := httptest.NewRecorder()
+	h.mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/set?key=a&value=1", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "POST /set?key=a&value=1" {
+		t.Fatalf("want request proxied to leader, got %d %q", w.Code, w.Body.String())
+	}
+	if forwarded == "" {
+		t.Fatal("want proxied request marked forwarded")
+	}
+	if w.Header().Get(leaderHeader) != leaderAddr {
+		t.Fatalf("want leader %s in header, got %q", leaderAddr, w.Header().Get(leaderHeader))
+	}
+
+	// forwarded again by a node which is not leader any more
+	r := httptest.NewRequest(http.MethodDelete, "/key?key=a", nil)
+	r.Header.Set(forwardedHeader, "1")
+	w = httptest.NewRecorder()
+	h.mux.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want forwarded request not forwarded again, got %d", w.Code)
+	}
+}
+
+func TestWriteWhileClosing(t *testing.T) {
+	h := newTestHTTPServer(forwardProxy, "127.0.0.1:6000")
+	h.setWriteFlag(true)
+	h.close()
+
+	w := httptest.NewRecorder()
+	h.mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/set?key=a&value=1", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want write rejected on shutdown, got %d", w.Code)
+	}
+}
+
+func TestForwardRedirect(t *testing.T) {
+	h := newTestHTTPServer(forwardRedirect, "127.0.0.1:6000")
+
+	w := httptest.NewRecorder()
+	h.mux.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/key?key=a", nil))
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "http://127.0.0.1:6000/key?key=a" {
+		t.Fatalf("want redirect to leader, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// no leader elected
+	h.leaderAddr = func() string { return "" }
+	w = httptest.NewRecorder()
+	h.mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/set?key=a&value=1", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want 503 without leader, got %d", w.Code)
+	}
+}
+
+func TestApplyFailed(t *testing.T) {
+	h := newTestHTTPServer(forwardProxy, "127.0.0.1:6001")
+
+	// not appended, safe to retry on leader
+	w := httptest.NewRecorder()
+	h.applyFailed(w, raft.ErrNotLeader)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get(leaderHeader) != "127.0.0.1:6001" {
+		t.Fatalf("want 503 with leader, got %d %q", w.Code, w.Header().Get(leaderHeader))
+	}
+
+	// may be committed by new leader
+	w = httptest.NewRecorder()
+	h.applyFailed(w, raft.ErrLeadershipLost)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("want 500 of leadership lost, got %d", w.Code)
+	}
+}
@@ -2,8 +2,11 @@ package raft
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"sync/atomic"
 
 	"github.com/hashicorp/raft"
 )
@@ -11,30 +14,100 @@ import (
 // FMS: finite state machine 有限状态机
 
 type FSM struct {
-	ctx *raftContext
-	log *log.Logger
+	ctx     *raftContext
+	log     *log.Logger
+	applied uint64 // index of last log entry applied, or of snapshot restored
 }
 
-type logEntryData struct {
-	Key   string
-	Value string
+// AppliedIndex - index of last log entry the state reflects
+func (f *FSM) AppliedIndex() uint64 {
+	return atomic.LoadUint64(&f.applied)
 }
 
+// Apply - apply command of log entry, returns applyResult, or error if command is invalid.
+// it never reads clock, so all nodes agree on conditions and expiry
 func (f *FSM) Apply(logEntry *raft.Log) interface{} {
-	e := logEntryData{}
-	if err := json.Unmarshal(logEntry.Data, &e); err != nil {
+	defer atomic.StoreUint64(&f.applied, logEntry.Index)
+
+	c, err := decodeCommand(logEntry.Data)
+	if err != nil {
 		panic("Failed unmarshaling Raft log entry. This is a bug.")
 	}
 
-	f.ctx.rs.cm.Set(e.Key, e.Value)
 	f.log.Printf("fms.Apply(), logEntry:%s\n", logEntry.Data)
-	return nil
+	switch c.Op {
+	case opSet:
+		var d logEntryData
+		if err = c.decodeData(&d); err != nil {
+			return err
+		}
+		if v, ok := f.ctx.rs.cm.matches(d.Key, d.PrevVersion, d.Now); !ok {
+			return applyResult{Version: v}
+		}
+		f.ctx.rs.cm.Set(d.Key, d.Value, d.ExpireAt, logEntry.Index)
+		return applyResult{Applied: true, Version: logEntry.Index}
+	case opDelete:
+		var d deleteData
+		if err = c.decodeData(&d); err != nil {
+			return err
+		}
+		if v, ok := f.ctx.rs.cm.matches(d.Key, d.PrevVersion, d.Now); !ok {
+			return applyResult{Version: v}
+		}
+		return applyResult{Applied: f.ctx.rs.cm.Delete(d.Key)}
+	case opExpire:
+		var d expireData
+		if err = c.decodeData(&d); err != nil {
+			return err
+		}
+		return applyResult{Applied: f.ctx.rs.cm.Expire(d.Key, d.ExpireAt)}
+	case opNode:
+		var d nodeData
+		if err = c.decodeData(&d); err != nil {
+			return err
+		}
+		f.ctx.rs.nodes.Set(d.RaftAddr, d.HTTPAddr)
+		return applyResult{Applied: true}
+	default:
+		// written by newer version, skipped so all nodes stay the same
+		return fmt.Errorf("unknown command %q", c.Op)
+	}
 }
 
+// Snapshot - copy of state taken between Apply calls, Persist runs concurrently with later Apply
 func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
-	return &snapshot{cm: f.ctx.rs.cm}, nil
+	cache, err := f.ctx.rs.cm.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(snapshotData{Format: snapshotFormat, Index: f.AppliedIndex(), Cache: cache, Nodes: f.ctx.rs.nodes.all()})
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot{data: data}, nil
 }
 
+// Restore - restore snapshot of current format, or of cache only taken by old version
 func (f *FSM) Restore(serialized io.ReadCloser) error {
-	return f.ctx.rs.cm.UnMarshal(serialized)
+	defer serialized.Close()
+
+	b, err := ioutil.ReadAll(serialized)
+	if err != nil {
+		return err
+	}
+
+	var data snapshotData
+	if json.Unmarshal(b, &data) != nil || data.Format != snapshotFormat {
+		return f.ctx.rs.cm.UnMarshal(b)
+	}
+
+	if err = f.ctx.rs.cm.UnMarshal(data.Cache); err != nil {
+		return err
+	}
+	f.ctx.rs.nodes.restore(data.Nodes)
+	atomic.StoreUint64(&f.applied, data.Index)
+
+	return nil
 }
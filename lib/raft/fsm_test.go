@@ -0,0 +1,286 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func newTestFSM() *FSM {
+	rs := &raftService{cm: NewCacheManager(), nodes: new(nodeRegistry)}
+	return &FSM{ctx: &raftContext{rs: rs}, log: log.New(ioutil.Discard, "", 0)}
+}
+
+var testIndex uint64
+
+// applyCommand - apply command at next raft index
+func applyCommand(t *testing.T, f *FSM, op commandOp, data interface{}) interface{} {
+	t.Helper()
+	b, err := newCommand(op, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testIndex++
+	return f.Apply(&raft.Log{Index: testIndex, Data: b})
+}
+
+// memorySnapshotSink - raft.SnapshotSink writing into memory
+type memorySnapshotSink struct {
+	bytes.Buffer
+	cancelled bool
+}
+
+func (s *memorySnapshotSink) ID() string    { return "memory" }
+func (s *memorySnapshotSink) Close() error  { return nil }
+func (s *memorySnapshotSink) Cancel() error { s.cancelled = true; return nil }
+
+func TestFSMApply(t *testing.T) {
+	f := newTestFSM()
+	cm := f.ctx.rs.cm
+
+	if resp := applyCommand(t, f, opSet, logEntryData{Key: "a", Value: "1"}); resp != (applyResult{Applied: true, Version: testIndex}) {
+		t.Fatalf("want applied at %d, got %v", testIndex, resp)
+	}
+
+	// entries written before command envelope are sets
+	legacy, _ := json.Marshal(logEntryData{Key: "b", Value: "2"})
+	f.Apply(&raft.Log{Data: legacy})
+
+	if v, ok := cm.Get("a"); !ok || v != "1" {
+		t.Fatalf("want a=1, got %q %v", v, ok)
+	}
+	if v, ok := cm.Get("b"); !ok || v != "2" {
+		t.Fatalf("want b=2, got %q %v", v, ok)
+	}
+
+	if resp := applyCommand(t, f, opDelete, deleteData{Key: "a"}); resp != (applyResult{Applied: true}) {
+		t.Fatalf("want existing key deleted, got %v", resp)
+	}
+	if _, ok := cm.Get("a"); ok {
+		t.Fatal("want a deleted")
+	}
+	if resp := applyCommand(t, f, opDelete, deleteData{Key: "a"}); resp != (applyResult{}) {
+		t.Fatalf("want missing key not deleted, got %v", resp)
+	}
+
+	if _, ok := applyCommand(t, f, commandOp("incr"), deleteData{Key: "b"}).(error); !ok {
+		t.Fatal("want error of unknown command")
+	}
+	if v, ok := cm.Get("b"); !ok || v != "2" {
+		t.Fatal("want b untouched by unknown command")
+	}
+}
+
+func TestFSMSnapshotRestore(t *testing.T) {
+	f := newTestFSM()
+	applyCommand(t, f, opSet, logEntryData{Key: "a", Value: "1"})
+	applyCommand(t, f, opSet, logEntryData{Key: "b", Value: "2"})
+	applyCommand(t, f, opDelete, deleteData{Key: "a"})
+	index := testIndex
+
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// applied while snapshot is persisted, not in it
+	applyCommand(t, f, opSet, logEntryData{Key: "c", Value: "3"})
+	applyCommand(t, f, opNode, nodeData{RaftAddr: "127.0.0.1:7000", HTTPAddr: "127.0.0.1:6000"})
+
+	sink := new(memorySnapshotSink)
+	if err = snap.Persist(sink); err != nil || sink.cancelled {
+		t.Fatalf("persist failed:%v cancelled:%v", err, sink.cancelled)
+	}
+	snap.Release()
+
+	// restored state replaces what was there, deleted key does not come back
+	restored := newTestFSM()
+	applyCommand(t, restored, opSet, logEntryData{Key: "a", Value: "stale"})
+	if err = restored.Restore(ioutil.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+
+	cm := restored.ctx.rs.cm
+	if _, ok := cm.Get("a"); ok {
+		t.Fatal("want deleted key absent after restore")
+	}
+	if v, ok := cm.Get("b"); !ok || v != "2" {
+		t.Fatalf("want b=2 after restore, got %q %v", v, ok)
+	}
+	if _, ok := cm.Get("c"); ok || len(restored.ctx.rs.nodes.all()) != 0 {
+		t.Fatal("want state applied after snapshot absent")
+	}
+	if applied := restored.AppliedIndex(); applied != index {
+		t.Fatalf("want applied index %d of snapshot, got %d", index, applied)
+	}
+}
+
+func TestFSMNodes(t *testing.T) {
+	f := newTestFSM()
+	applyCommand(t, f, opSet, logEntryData{Key: "a", Value: "1"})
+	if resp := applyCommand(t, f, opNode, nodeData{RaftAddr: "127.0.0.1:7000", HTTPAddr: "127.0.0.1:6000"}); resp != (applyResult{Applied: true}) {
+		t.Fatalf("want node applied, got %v", resp)
+	}
+	applyCommand(t, f, opNode, nodeData{RaftAddr: "127.0.0.1:7001", HTTPAddr: "127.0.0.1:6001"})
+
+	snap, _ := f.Snapshot()
+	sink := new(memorySnapshotSink)
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newTestFSM()
+	restored.ctx.rs.nodes.Set("127.0.0.1:7002", "127.0.0.1:6002")
+	if err := restored.Restore(ioutil.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"127.0.0.1:7000": "127.0.0.1:6000", "127.0.0.1:7001": "127.0.0.1:6001"}
+	if nodes := restored.ctx.rs.nodes.all(); !reflect.DeepEqual(nodes, want) {
+		t.Fatalf("want nodes %v after restore, got %v", want, nodes)
+	}
+	if index := restored.AppliedIndex(); index != testIndex {
+		t.Fatalf("want applied index %d of snapshot, got %d", testIndex, index)
+	}
+	if v, ok := restored.ctx.rs.cm.Get("a"); !ok || v != "1" {
+		t.Fatalf("want a=1 after restore, got %q %v", v, ok)
+	}
+
+	// cache of old snapshot may have key named format
+	legacy := newTestFSM()
+	if err := legacy.Restore(ioutil.NopCloser(strings.NewReader(`{"format":"2"}`))); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := legacy.ctx.rs.cm.Get("format"); !ok || v != "2" {
+		t.Fatalf("want format=2 of old snapshot, got %q %v", v, ok)
+	}
+}
+
+func TestFSMExpire(t *testing.T) {
+	f := newTestFSM()
+	cm := f.ctx.rs.cm
+	past := time.Now().Add(-time.Second).UnixNano()
+	future := time.Now().Add(time.Hour).UnixNano()
+
+	applyCommand(t, f, opSet, logEntryData{Key: "expired", Value: "1", ExpireAt: past})
+	applyCommand(t, f, opSet, logEntryData{Key: "alive", Value: "2", ExpireAt: future})
+	applyCommand(t, f, opSet, logEntryData{Key: "forever", Value: "3"})
+
+	// hidden as soon as expired, before reaper deletes it
+	if _, ok := cm.Get("expired"); ok {
+		t.Fatal("want expired key hidden")
+	}
+	if v, ok := cm.Get("alive"); !ok || v != "2" {
+		t.Fatalf("want alive=2, got %q %v", v, ok)
+	}
+
+	keys := cm.expired(time.Now(), reapBatch)
+	if len(keys) != 1 || keys[0] != (expireData{Key: "expired", ExpireAt: past}) {
+		t.Fatalf("unexpected expired keys %v", keys)
+	}
+
+	// set again after reaper found it, not deleted by stale expire
+	applyCommand(t, f, opSet, logEntryData{Key: "expired", Value: "4"})
+	if resp := applyCommand(t, f, opExpire, keys[0]); resp != (applyResult{}) {
+		t.Fatalf("want key set again not expired, got %v", resp)
+	}
+	if v, ok := cm.Get("expired"); !ok || v != "4" {
+		t.Fatalf("want expired=4, got %q %v", v, ok)
+	}
+
+	applyCommand(t, f, opSet, logEntryData{Key: "alive", Value: "2", ExpireAt: past})
+	if resp := applyCommand(t, f, opExpire, expireData{Key: "alive", ExpireAt: past}); resp != (applyResult{Applied: true}) {
+		t.Fatalf("want key expired, got %v", resp)
+	}
+	if len(cm.expired(time.Now(), reapBatch)) != 0 {
+		t.Fatal("want no expired key left")
+	}
+}
+
+func TestFSMRestoreTTL(t *testing.T) {
+	f := newTestFSM()
+	future := time.Now().Add(time.Hour).UnixNano()
+	applyCommand(t, f, opSet, logEntryData{Key: "a", Value: "1", ExpireAt: future})
+
+	snap, _ := f.Snapshot()
+	sink := new(memorySnapshotSink)
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newTestFSM()
+	if err := restored.Restore(ioutil.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+
+	v, ok := restored.ctx.rs.cm.m.Load("a")
+	if !ok || *v.(*cacheEntry) != (cacheEntry{Value: "1", ExpireAt: future, Version: testIndex}) {
+		t.Fatalf("want ttl kept by snapshot, got %v", v)
+	}
+
+	// snapshot taken before ttl
+	legacy := newTestFSM()
+	if err := legacy.Restore(ioutil.NopCloser(strings.NewReader(`{"a":"1"}`))); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := legacy.ctx.rs.cm.Get("a"); !ok || v != "1" {
+		t.Fatalf("want a=1 of old snapshot, got %q %v", v, ok)
+	}
+}
+
+func TestFSMConditions(t *testing.T) {
+	f := newTestFSM()
+	zero := uint64(0)
+	now := time.Now().UnixNano()
+
+	// set if absent
+	created := applyCommand(t, f, opSet, logEntryData{Key: "a", Value: "1", condition: condition{PrevVersion: &zero, Now: now}})
+	if created != (applyResult{Applied: true, Version: testIndex}) {
+		t.Fatalf("want created, got %v", created)
+	}
+	version := created.(applyResult).Version
+
+	if resp := applyCommand(t, f, opSet, logEntryData{Key: "a", Value: "2", condition: condition{PrevVersion: &zero, Now: now}}); resp != (applyResult{Version: version}) {
+		t.Fatalf("want set if absent failed with current version, got %v", resp)
+	}
+
+	// compare and swap
+	stale := version - 1
+	if resp := applyCommand(t, f, opSet, logEntryData{Key: "a", Value: "2", condition: condition{PrevVersion: &stale, Now: now}}); resp != (applyResult{Version: version}) {
+		t.Fatalf("want cas of stale version failed, got %v", resp)
+	}
+	swapped := applyCommand(t, f, opSet, logEntryData{Key: "a", Value: "2", condition: condition{PrevVersion: &version, Now: now}})
+	if swapped != (applyResult{Applied: true, Version: testIndex}) {
+		t.Fatalf("want swapped, got %v", swapped)
+	}
+	if v, _ := f.ctx.rs.cm.Get("a"); v != "2" {
+		t.Fatalf("want a=2, got %q", v)
+	}
+
+	// delete if version
+	current := swapped.(applyResult).Version
+	if resp := applyCommand(t, f, opDelete, deleteData{Key: "a", condition: condition{PrevVersion: &version, Now: now}}); resp != (applyResult{Version: current}) {
+		t.Fatalf("want delete of old version failed, got %v", resp)
+	}
+	version = current
+	if resp := applyCommand(t, f, opDelete, deleteData{Key: "a", condition: condition{PrevVersion: &version, Now: now}}); resp != (applyResult{Applied: true}) {
+		t.Fatalf("want deleted, got %v", resp)
+	}
+
+	// key expired at leader time is absent, whatever clock of follower says
+	applyCommand(t, f, opSet, logEntryData{Key: "b", Value: "1", ExpireAt: now + 10})
+	if resp := applyCommand(t, f, opSet, logEntryData{Key: "b", Value: "2", condition: condition{PrevVersion: &zero, Now: now + 10}}); !resp.(applyResult).Applied {
+		t.Fatalf("want expired key taken as absent, got %v", resp)
+	}
+	if resp := applyCommand(t, f, opSet, logEntryData{Key: "b", Value: "3", condition: condition{PrevVersion: &zero, Now: now}}); resp.(applyResult).Applied {
+		t.Fatalf("want key of no ttl present, got %v", resp)
+	}
+}
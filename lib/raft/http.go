@@ -1,10 +1,10 @@
 package raft
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -16,11 +16,17 @@ const (
 	UnableWriteNode uint32 = 1
 )
 
+// versionHeader - version of key, raft index it was last set at
+const versionHeader = "X-Cache-Version"
+
 type httpServer struct {
 	ctx         *raftContext
 	mux         *http.ServeMux
 	logger      *log.Logger
 	enableWrite uint32
+	closing     uint32        // set on shutdown, writes are rejected
+	forward     string        // proxy or redirect
+	leaderAddr  func() string // http address of leader, empty if unknown
 }
 
 func newHttpServer(ctx *raftContext, l *log.Logger) *httpServer {
@@ -30,11 +36,22 @@ func newHttpServer(ctx *raftContext, l *log.Logger) *httpServer {
 		mux:         mux,
 		enableWrite: UnableWriteNode,
 		logger:      l,
+		forward:     forwardProxy,
+	}
+	hs.leaderAddr = hs.leaderHTTPAddr
+	if ctx.rs.cfg != nil && ctx.rs.cfg.Forward != "" {
+		hs.forward = ctx.rs.cfg.Forward
 	}
 
+	// 写请求只能在 leader 上执行, follower 转发给 leader
 	mux.HandleFunc("/get", hs.getHandler)
-	mux.HandleFunc("/set", hs.setHandler)
-	mux.HandleFunc("/join", hs.joinHandler)
+	mux.HandleFunc("/set", hs.writeHandler(hs.setHandler))
+	mux.HandleFunc("/key", hs.writeHandler(hs.keyHandler))
+	mux.HandleFunc("/join", hs.writeHandler(hs.joinHandler))
+	mux.HandleFunc("/remove", hs.writeHandler(hs.removeHandler))
+	mux.HandleFunc("/transfer", hs.writeHandler(hs.transferHandler))
+	mux.HandleFunc("/members", hs.membersHandler)
+	mux.HandleFunc("/stats", hs.statsHandler)
 
 	return hs
 }
@@ -43,6 +60,15 @@ func (h *httpServer) enableWriteNode() bool {
 	return atomic.LoadUint32(&h.enableWrite) == EnableWriteNode
 }
 
+// close - reject writes, reads are still served until http server is shut down
+func (h *httpServer) close() {
+	atomic.StoreUint32(&h.closing, 1)
+}
+
+func (h *httpServer) isClosing() bool {
+	return atomic.LoadUint32(&h.closing) == 1
+}
+
 func (h *httpServer) setWriteFlag(enable bool) {
 	if enable {
 		atomic.StoreUint32(&h.enableWrite, EnableWriteNode)
@@ -51,10 +77,36 @@ func (h *httpServer) setWriteFlag(enable bool) {
 	}
 }
 
+// getHandler - GET /get?key=xxx[&consistency=stale|leader|linearizable], stale if not given.
+// reads other than stale are served by leader, index the state read reflects is in response header
 func (h *httpServer) getHandler(w http.ResponseWriter, r *http.Request) {
 	h.logger.Printf("%s | %d", r.RequestURI, http.StatusOK)
 	key := r.URL.Query().Get("key")
-	val, ok := h.ctx.rs.cm.Get(key)
+	level := r.URL.Query().Get("consistency")
+	if level == "" {
+		level = consistencyStale
+	}
+
+	if !validConsistency(level) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid consistency"))
+		return
+	}
+
+	if level != consistencyStale && !h.enableWriteNode() {
+		h.forwardToLeader(w, r)
+		return
+	}
+
+	if err := h.ctx.rs.readBarrier(level); err != nil {
+		h.logger.Printf("read barrier failed:%v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set(indexHeader, strconv.FormatUint(h.ctx.rs.node.fsm.AppliedIndex(), 10))
+	e, ok := h.ctx.rs.cm.lookup(key, time.Now().UnixNano())
 
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
@@ -62,7 +114,8 @@ func (h *httpServer) getHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := w.Write([]byte(val))
+	w.Header().Set(versionHeader, strconv.FormatUint(e.Version, 10))
+	_, err := w.Write([]byte(e.Value))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -74,7 +127,7 @@ func (h *httpServer) getHandler(w http.ResponseWriter, r *http.Request) {
 func (h *httpServer) setHandler(w http.ResponseWriter, r *http.Request) {
 	h.logger.Printf("%s | %d", r.RequestURI, http.StatusOK)
 	if !h.enableWriteNode() {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.applyFailed(w, raft.ErrNotLeader)
 		return
 	}
 
@@ -86,19 +139,33 @@ func (h *httpServer) setHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	event := logEntryData{Key: key, Value: val}
-	eventBytes, err := json.Marshal(event)
+	if !h.readCondition(w, r, &event.condition) {
+		return
+	}
+
+	if s := r.FormValue("ttl"); s != "" {
+		ttl, err := time.ParseDuration(s)
+		if err != nil || ttl <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid ttl"))
+			return
+		}
+
+		// deadline is decided here by leader, followers apply the same one
+		event.ExpireAt = time.Now().Add(ttl).UnixNano()
+	}
+
+	resp, err := h.ctx.rs.apply(opSet, event)
 	if err != nil {
-		h.logger.Printf("json.Marshal failed, err:%v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, "internal error\n")
+		h.applyFailed(w, err)
 		return
 	}
 
-	applyFuture := h.ctx.rs.node.raft.Apply(eventBytes, 5*time.Second)
-	if err := applyFuture.Error(); err != nil {
-		h.logger.Printf("raft.Apply failed:%v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, "internal error\n")
+	result := resp.(applyResult)
+	w.Header().Set(versionHeader, strconv.FormatUint(result.Version, 10))
+	if !result.Applied {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("version mismatch"))
 		return
 	}
 
@@ -106,22 +173,127 @@ func (h *httpServer) setHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// applyFailed - 没有提交的写返回 503 和 leader 地址, 客户端可以重试. 其他错误比如
+// raft.ErrLeadershipLost 不知道是否已提交, 返回 500
+func (h *httpServer) applyFailed(w http.ResponseWriter, err error) {
+	h.logger.Printf("apply failed:%v", err)
+	switch err {
+	case raft.ErrNotLeader, raft.ErrRaftShutdown, raft.ErrEnqueueTimeout:
+		if leader := h.leaderAddr(); leader != "" {
+			w.Header().Set(leaderHeader, leader)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("not leader"))
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "internal error\n")
+	}
+}
+
+// keyHandler - DELETE /key?key=xxx[&version=n]
+func (h *httpServer) keyHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger.Printf("%s %s", r.Method, r.RequestURI)
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.enableWriteNode() {
+		h.applyFailed(w, raft.ErrNotLeader)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+
+	event := deleteData{Key: key}
+	if !h.readCondition(w, r, &event.condition) {
+		return
+	}
+
+	resp, err := h.ctx.rs.apply(opDelete, event)
+	if err != nil {
+		h.applyFailed(w, err)
+		return
+	}
+
+	switch result := resp.(applyResult); {
+	case result.Applied:
+		w.Write([]byte("ok"))
+	case result.Version != 0:
+		w.Header().Set(versionHeader, strconv.FormatUint(result.Version, 10))
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("version mismatch"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+	}
+}
+
+// readCondition - version=n only changes key of version n, version=0 only if key is absent.
+// bad request is responded if invalid
+func (h *httpServer) readCondition(w http.ResponseWriter, r *http.Request, c *condition) bool {
+	// decided by leader, followers check expiry at the same time
+	c.Now = time.Now().UnixNano()
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid form"))
+		return false
+	}
+
+	vs, ok := r.Form["version"]
+	if !ok {
+		return true
+	}
+
+	v, err := strconv.ParseUint(vs[0], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid version"))
+		return false
+	}
+
+	c.PrevVersion = &v
+	return true
+}
+
 func (h *httpServer) joinHandler(w http.ResponseWriter, r *http.Request) {
 	h.logger.Printf("%s | %d", r.RequestURI, http.StatusOK)
 	peerAddr := r.URL.Query().Get("peerAddr")
+	httpAddr := r.URL.Query().Get("httpAddr")
 	if peerAddr == "" {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("invalid peerAddr"))
 		return
 	}
 
-	if indexFeature := h.ctx.rs.node.raft.AddVoter(raft.ServerID(peerAddr), raft.ServerAddress(peerAddr), 0, 0); indexFeature.Error() != nil {
+	// nonvoter=true 加入为 learner, 只复制日志不参与投票
+	add := h.ctx.rs.node.raft.AddVoter
+	if nonvoter, _ := strconv.ParseBool(r.URL.Query().Get("nonvoter")); nonvoter {
+		add = h.ctx.rs.node.raft.AddNonvoter
+	}
+
+	if indexFeature := add(raft.ServerID(peerAddr), raft.ServerAddress(peerAddr), 0, 0); indexFeature.Error() != nil {
 		h.logger.Println(indexFeature.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("add voter err"))
 		return
 	}
 
+	if httpAddr != "" {
+		if _, err := h.ctx.rs.apply(opNode, nodeData{RaftAddr: peerAddr, HTTPAddr: httpAddr}); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("advertise node err"))
+			return
+		}
+	}
+
 	w.Write([]byte("ok"))
 
 }
@@ -0,0 +1,230 @@
+package raft
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/hashicorp/raft"
+)
+
+// member - 集群成员, 来自 raft 的配置
+type member struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	HTTPAddr string `json:"httpAddr,omitempty"`
+	Suffrage string `json:"suffrage"` // Voter, Nonvoter or Staging
+	State    string `json:"state"`    // Leader or Follower
+}
+
+// clusterStats - 本节点看到的集群状态
+type clusterStats struct {
+	ID           string `json:"id"`
+	State        string `json:"state"`
+	Leader       string `json:"leader"`
+	Term         uint64 `json:"term"`
+	LastIndex    uint64 `json:"lastIndex"`
+	CommitIndex  uint64 `json:"commitIndex"`
+	AppliedIndex uint64 `json:"appliedIndex"`
+}
+
+// members - servers of latest configuration, may not be committed yet
+func (rs *raftService) members() ([]member, error) {
+	future := rs.node.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+
+	leader := rs.node.raft.Leader()
+	servers := future.Configuration().Servers
+	members := make([]member, 0, len(servers))
+	for _, s := range servers {
+		m := member{
+			ID:       string(s.ID),
+			Address:  string(s.Address),
+			Suffrage: s.Suffrage.String(),
+			State:    raft.Follower.String(),
+		}
+		m.HTTPAddr, _ = rs.nodes.HTTPAddr(m.Address)
+		if s.Address == leader {
+			m.State = raft.Leader.String()
+		}
+		members = append(members, m)
+	}
+
+	return members, nil
+}
+
+func (rs *raftService) stats() clusterStats {
+	stats := rs.node.raft.Stats()
+	index := func(key string) uint64 {
+		v, _ := strconv.ParseUint(stats[key], 10, 64)
+		return v
+	}
+
+	return clusterStats{
+		ID:           rs.cfg.RaftAddr,
+		State:        stats["state"],
+		Leader:       string(rs.node.raft.Leader()),
+		Term:         index("term"),
+		LastIndex:    index("last_log_index"),
+		CommitIndex:  index("commit_index"),
+		AppliedIndex: index("applied_index"),
+	}
+}
+
+// membersHandler - GET /members
+func (h *httpServer) membersHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger.Printf("%s %s", r.Method, r.RequestURI)
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	members, err := h.ctx.rs.members()
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("get configuration err"))
+		return
+	}
+
+	h.writeJSON(w, members)
+}
+
+// statsHandler - GET /stats, leader, term and indexes from raft.Stats
+func (h *httpServer) statsHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger.Printf("%s %s", r.Method, r.RequestURI)
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.writeJSON(w, h.ctx.rs.stats())
+}
+
+// removeHandler - POST /remove?id=xxx, remove server from cluster
+func (h *httpServer) removeHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger.Printf("%s %s", r.Method, r.RequestURI)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid id"))
+		return
+	}
+
+	members, err := h.ctx.rs.members()
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("get configuration err"))
+		return
+	}
+
+	var addr string
+	for _, m := range members {
+		if m.ID == id {
+			addr = m.Address
+		}
+	}
+	if addr == "" {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+		return
+	}
+
+	// leader removing itself steps down once removed and can not apply any more,
+	// so its http address is deleted before
+	self := id == h.ctx.rs.cfg.RaftAddr
+	if self {
+		if _, err = h.ctx.rs.apply(opNode, nodeData{RaftAddr: addr}); err != nil {
+			h.logger.Printf("remove http address of %s failed:%v", addr, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("remove http address err"))
+			return
+		}
+	}
+
+	if err = h.ctx.rs.node.raft.RemoveServer(raft.ServerID(id), 0, 0).Error(); err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("remove server err"))
+		return
+	}
+
+	if !self {
+		if _, err = h.ctx.rs.apply(opNode, nodeData{RaftAddr: addr}); err != nil {
+			h.logger.Printf("remove http address of %s failed:%v", addr, err)
+		}
+	}
+
+	w.Write([]byte("ok"))
+}
+
+// transferHandler - POST /transfer[?id=xxx], transfer leadership to id, or to the most up to date follower
+func (h *httpServer) transferHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger.Printf("%s %s", r.Method, r.RequestURI)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		h.transferred(w, h.ctx.rs.node.raft.LeadershipTransfer())
+		return
+	}
+
+	members, err := h.ctx.rs.members()
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("get configuration err"))
+		return
+	}
+
+	var target *member
+	for i := range members {
+		if members[i].ID == id {
+			target = &members[i]
+		}
+	}
+	if target == nil || target.Suffrage != raft.Voter.String() {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid id, must be a voter"))
+		return
+	}
+
+	h.transferred(w, h.ctx.rs.node.raft.LeadershipTransferToServer(raft.ServerID(target.ID), raft.ServerAddress(target.Address)))
+}
+
+func (h *httpServer) transferred(w http.ResponseWriter, future raft.Future) {
+	if err := future.Error(); err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("leadership transfer err"))
+		return
+	}
+
+	w.Write([]byte("ok"))
+}
+
+func (h *httpServer) writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
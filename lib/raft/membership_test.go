@@ -0,0 +1,91 @@
+package raft
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func serveJSON(t *testing.T, h *httpServer, method, target string, v interface{}) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.mux.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	if v != nil && w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+	}
+
+	return w.Code
+}
+
+func TestMembership(t *testing.T) {
+	c := newTestCluster(t, 1)
+	defer c.shutdown()
+	leaderNode := c.waitLeader()
+	// neither bootstrapped nor joined, added as learner below
+	learnerNode := c.addConfig(Config{})
+	leader, learner := leaderNode.rs(), learnerNode.rs()
+
+	leaderID := leader.cfg.RaftAddr
+	learnerID := learner.cfg.RaftAddr
+	if code := serveJSON(t, leader.hService, http.MethodPost, "/join?nonvoter=true&httpAddr="+learnerNode.httpAddr+"&peerAddr="+learnerID, nil); code != http.StatusOK {
+		t.Fatalf("join failed: %d", code)
+	}
+
+	var members []member
+	if code := serveJSON(t, leader.hService, http.MethodGet, "/members", &members); code != http.StatusOK {
+		t.Fatalf("members failed: %d", code)
+	}
+	want := []member{
+		{ID: leaderID, Address: leaderID, HTTPAddr: leaderNode.httpAddr, Suffrage: "Voter", State: "Leader"},
+		{ID: learnerID, Address: learnerID, HTTPAddr: learnerNode.httpAddr, Suffrage: "Nonvoter", State: "Follower"},
+	}
+	if len(members) != 2 || members[0] != want[0] || members[1] != want[1] {
+		t.Fatalf("want members %+v, got %+v", want, members)
+	}
+
+	var stats clusterStats
+	serveJSON(t, leader.hService, http.MethodGet, "/stats", &stats)
+	if stats.ID != leaderID || stats.State != "Leader" || stats.Leader != leaderID ||
+		stats.Term == 0 || stats.CommitIndex == 0 || stats.LastIndex < stats.CommitIndex {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// learner never becomes leader
+	if code := serveJSON(t, leader.hService, http.MethodPost, "/transfer?id="+learnerID, nil); code != http.StatusBadRequest {
+		t.Fatalf("want transfer to learner rejected, got %d", code)
+	}
+
+	// learner replicates log
+	deadline := time.Now().Add(5 * time.Second)
+	for learner.node.fsm.AppliedIndex() < stats.CommitIndex {
+		if time.Now().After(deadline) {
+			t.Fatal("log not replicated to learner")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if learner.node.raft.State() != raft.Follower {
+		t.Fatalf("want learner follower, got %s", learner.node.raft.State())
+	}
+
+	if code := serveJSON(t, leader.hService, http.MethodPost, "/remove?id=unknown", nil); code != http.StatusNotFound {
+		t.Fatalf("want unknown server not found, got %d", code)
+	}
+	if code := serveJSON(t, leader.hService, http.MethodPost, "/remove?id="+learnerID, nil); code != http.StatusOK {
+		t.Fatalf("remove failed: %d", code)
+	}
+
+	members = nil
+	serveJSON(t, leader.hService, http.MethodGet, "/members", &members)
+	if len(members) != 1 || members[0].ID != leaderID {
+		t.Fatalf("want leader left only, got %+v", members)
+	}
+	if _, ok := leader.nodes.HTTPAddr(learnerID); ok {
+		t.Fatal("want http address of removed node deleted")
+	}
+}
@@ -19,33 +19,62 @@ type raftNode struct {
 	raft             *raft.Raft
 	fsm              *FSM
 	leaderNotifyChan chan bool
+
+	trans       *raft.NetworkTransport
+	logStore    *raftboltdb.BoltStore
+	stableStore *raftboltdb.BoltStore
+}
+
+// raftDeps - raft 的 transport 和 store. 测试通过 Config.deps 注入内存中的, store 不会被关闭, 重启节点时可以复用
+type raftDeps struct {
+	trans  raft.Transport
+	logs   raft.LogStore
+	stable raft.StableStore
+	snaps  raft.SnapshotStore
+	config func(*raft.Config) // 修改 raft 配置, 可以为 nil
 }
 
-func newRaftTransport(cfg *config) (*raft.NetworkTransport, error) {
-	addr, err := net.ResolveTCPAddr("tcp", cfg.raftTCPAddr)
+func newRaftTransport(cfg *Config) (*raft.NetworkTransport, error) {
+	addr, err := net.ResolveTCPAddr("tcp", cfg.RaftAddr)
 	if err != nil {
 		return nil, err
 	}
 
-	return raft.NewTCPTransport(addr.String(), addr, 3, 10*time.Second, os.Stderr)
+	// 端口为 0 时监听随机端口, 对外使用实际监听的地址
+	var advertise net.Addr = addr
+	if addr.Port == 0 {
+		advertise = nil
+	}
+
+	return raft.NewTCPTransport(addr.String(), advertise, 3, 10*time.Second, os.Stderr)
 }
 
-func newRaftNode(cfg *config, ctx *raftContext) (*raftNode, error) {
+func newRaftNode(cfg *Config, ctx *raftContext) (_ *raftNode, err error) {
+	n := new(raftNode)
+	defer func() {
+		// 失败时关闭已打开的 transport 和 store
+		if err != nil {
+			n.close()
+		}
+	}()
+
+	deps := cfg.deps
+	if deps == nil {
+		if deps, err = n.open(cfg); err != nil {
+			return nil, err
+		}
+	}
+	cfg.RaftAddr = string(deps.trans.LocalAddr())
+
 	raftConfig := raft.DefaultConfig()
-	raftConfig.LocalID = raft.ServerID(cfg.raftTCPAddr)
-	raftConfig.Logger = log.New(os.Stderr, "[raft]", log.LstdFlags)
+	raftConfig.LocalID = raft.ServerID(cfg.RaftAddr)
+	raftConfig.LogOutput = os.Stderr
 	raftConfig.SnapshotInterval = 20 * time.Second
 	raftConfig.SnapshotThreshold = 2
 	leaderNotifyCh := make(chan bool, 1)
 	raftConfig.NotifyCh = leaderNotifyCh
-
-	trans, err := newRaftTransport(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if err = os.MkdirAll(cfg.dataDir, 0700); err != nil {
-		return nil, err
+	if deps.config != nil {
+		deps.config(raftConfig)
 	}
 
 	fsm := &FSM{
@@ -53,44 +82,85 @@ func newRaftNode(cfg *config, ctx *raftContext) (*raftNode, error) {
 		log: log.New(os.Stderr, "[FSM]", log.LstdFlags),
 	}
 
-	snapshotStore, err := raft.NewFileSnapshotStore(cfg.dataDir, 1, os.Stderr)
+	newRaft, err := raft.NewRaft(raftConfig, fsm, deps.logs, deps.stable, deps.snaps, deps.trans)
 	if err != nil {
 		return nil, err
 	}
 
-	logStore, err := raftboltdb.NewBoltStore(filepath.Join(cfg.dataDir, "raft-log.bolt"))
+	if cfg.Bootstrap {
+		configuration := raft.Configuration{
+			Servers: []raft.Server{
+				{
+					ID:      raftConfig.LocalID,
+					Address: deps.trans.LocalAddr(),
+				},
+			},
+		}
+
+		newRaft.BootstrapCluster(configuration)
+	}
+
+	n.raft, n.fsm, n.leaderNotifyChan = newRaft, fsm, leaderNotifyCh
+	return n, nil
+}
+
+// open - tcp transport 和 DataDir 下的 store, 由 close 关闭
+func (n *raftNode) open(cfg *Config) (*raftDeps, error) {
+	trans, err := newRaftTransport(cfg)
 	if err != nil {
 		return nil, err
 	}
+	n.trans = trans
 
-	stableStore, err := raftboltdb.NewBoltStore(filepath.Join(cfg.dataDir, "raft-stable.bolt"))
-	if err != nil {
+	if err = os.MkdirAll(cfg.DataDir, 0700); err != nil {
 		return nil, err
 	}
 
-	newRaft, err := raft.NewRaft(raftConfig, fsm, logStore, stableStore, snapshotStore, trans)
+	snapshotStore, err := raft.NewFileSnapshotStore(cfg.DataDir, 1, os.Stderr)
 	if err != nil {
 		return nil, err
 	}
 
-	if cfg.startAsLeader {
-		configuration := raft.Configuration{
-			Servers: []raft.Server{
-				{
-					ID:      raftConfig.LocalID,
-					Address: trans.LocalAddr(),
-				},
-			},
+	if n.logStore, err = raftboltdb.NewBoltStore(filepath.Join(cfg.DataDir, "raft-log.bolt")); err != nil {
+		return nil, err
+	}
+
+	if n.stableStore, err = raftboltdb.NewBoltStore(filepath.Join(cfg.DataDir, "raft-stable.bolt")); err != nil {
+		return nil, err
+	}
+
+	return &raftDeps{trans: trans, logs: n.logStore, stable: n.stableStore, snaps: snapshotStore}, nil
+}
+
+// close - shutdown raft, then close transport and stores, which raft does not close
+func (n *raftNode) close() error {
+	var err error
+	if n.raft != nil {
+		err = n.raft.Shutdown().Error()
+	}
+
+	keep := func(cerr error) {
+		if err == nil {
+			err = cerr
 		}
+	}
 
-		newRaft.BootstrapCluster(configuration)
+	// raft closes transport on shutdown as well, close again does nothing
+	if n.trans != nil {
+		keep(n.trans.Close())
+	}
+	if n.logStore != nil {
+		keep(n.logStore.Close())
+	}
+	if n.stableStore != nil {
+		keep(n.stableStore.Close())
 	}
 
-	return &raftNode{raft: newRaft, fsm: fsm, leaderNotifyChan: leaderNotifyCh}, nil
+	return err
 }
 
-func joinRaftCluster(cfg *config) error {
-	url := fmt.Sprintf("http://%s/join?peerAddr=%s", cfg.joinAddr, cfg.raftTCPAddr)
+func joinRaftCluster(cfg *Config) error {
+	url := fmt.Sprintf("http://%s/join?peerAddr=%s&httpAddr=%s&nonvoter=%t", cfg.JoinAddr, cfg.RaftAddr, cfg.HTTPAddr, cfg.Nonvoter)
 
 	resp, err := http.Get(url)
 	if err != nil {
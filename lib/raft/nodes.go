@@ -0,0 +1,64 @@
+package raft
+
+import (
+	"log"
+	"sync"
+)
+
+// nodeRegistry - 集群节点的 http 地址, key 为 raft 地址, 通过 raft 复制到所有节点
+type nodeRegistry struct {
+	m sync.Map
+}
+
+// Set - node is removed if httpAddr is empty
+func (nr *nodeRegistry) Set(raftAddr, httpAddr string) {
+	if httpAddr == "" {
+		nr.m.Delete(raftAddr)
+		return
+	}
+
+	nr.m.Store(raftAddr, httpAddr)
+}
+
+// HTTPAddr - http address of node at raftAddr
+func (nr *nodeRegistry) HTTPAddr(raftAddr string) (string, bool) {
+	v, ok := nr.m.Load(raftAddr)
+	if !ok {
+		return "", false
+	}
+
+	return v.(string), true
+}
+
+func (nr *nodeRegistry) all() map[string]string {
+	nodes := make(map[string]string)
+	nr.m.Range(func(k, v interface{}) bool {
+		nodes[k.(string)] = v.(string)
+		return true
+	})
+
+	return nodes
+}
+
+func (nr *nodeRegistry) restore(nodes map[string]string) {
+	nr.m.Range(func(k, _ interface{}) bool {
+		nr.m.Delete(k)
+		return true
+	})
+
+	for raftAddr, httpAddr := range nodes {
+		nr.m.Store(raftAddr, httpAddr)
+	}
+}
+
+// advertise - 成为 leader 后记录自己的 http 地址, follower 据此转发写请求
+func (rs *raftService) advertise() {
+	d := nodeData{RaftAddr: rs.cfg.RaftAddr, HTTPAddr: rs.cfg.HTTPAddr}
+	if httpAddr, ok := rs.nodes.HTTPAddr(d.RaftAddr); ok && httpAddr == d.HTTPAddr {
+		return
+	}
+
+	if _, err := rs.apply(opNode, d); err != nil {
+		log.Printf("advertise http address failed:%v", err)
+	}
+}
@@ -5,17 +5,15 @@
 package raft
 
 import (
-	"fmt"
 	"log"
-	"net"
-	"net/http"
-	"os"
+	"time"
 )
 
 type raftService struct {
 	hService *httpServer
-	cfg      *config
+	cfg      *Config
 	cm       *cacheManager
+	nodes    *nodeRegistry
 	node     *raftNode
 }
 
@@ -23,55 +21,25 @@ type raftContext struct {
 	rs *raftService
 }
 
-func Server() {
-	rs := &raftService{
-		cfg: NewConfig(),
-		cm:  NewCacheManager(),
-	}
-
-	ctx := &raftContext{rs: rs}
-
-	var l net.Listener
-	var err error
-	l, err = net.Listen("tcp", rs.cfg.httpAddr)
-	if err != nil {
-		log.Fatal(fmt.Sprintf("listen %s failed: %s", rs.cfg.httpAddr, err))
-	}
-	log.Printf("http server listen:%s", l.Addr())
-
-	logger := log.New(os.Stderr, "[httpServer]", log.Ldate|log.Ltime)
-	httpServer := newHttpServer(ctx, logger)
-	rs.hService = httpServer
-	go func() {
-		http.Serve(l, httpServer.mux)
-	}()
-
-	node, err := newRaftNode(rs.cfg, ctx)
+// apply - replicate command by raft, returns response of FSM.Apply
+func (rs *raftService) apply(op commandOp, data interface{}) (interface{}, error) {
+	b, err := newCommand(op, data)
 	if err != nil {
-		log.Fatal(fmt.Sprintf("new raft node failed:%v", err))
+		log.Printf("json.Marshal failed, err:%v", err)
+		return nil, err
 	}
 
-	rs.node = node
-
-	if rs.cfg.joinAddr != "" {
-		err = joinRaftCluster(rs.cfg)
-		if err != nil {
-			log.Fatal(fmt.Sprintf("join raft cluster failed:%v", err))
-		}
+	applyFuture := rs.node.raft.Apply(b, 5*time.Second)
+	if err = applyFuture.Error(); err != nil {
+		log.Printf("raft.Apply failed:%v", err)
+		return nil, err
 	}
 
-	// monitor leadership
-	for {
-		select {
-		case leader := <-rs.node.leaderNotifyChan:
-			if leader {
-				log.Println("become leader, enable write api")
-				rs.hService.setWriteFlag(true)
-			} else {
-				log.Println("become follower, close write api")
-				rs.hService.setWriteFlag(false)
-			}
-		}
+	resp := applyFuture.Response()
+	if err, ok := resp.(error); ok {
+		log.Printf("apply %s failed:%v", op, err)
+		return nil, err
 	}
 
+	return resp, nil
 }
@@ -0,0 +1,180 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+// Server - raft cache 节点, 可以嵌入其他程序, 也可以在同一进程中启动多个
+type Server struct {
+	rs *raftService
+
+	lock     sync.Mutex
+	started  bool
+	listener net.Listener
+	http     *http.Server
+	stop     chan struct{} // closed by Shutdown
+	done     chan struct{} // closed when leadership loop exits
+}
+
+// NewServer - server of cfg, not started
+func NewServer(cfg *Config) (*Server, error) {
+	c := *cfg
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		rs: &raftService{
+			cfg:   &c,
+			cm:    NewCacheManager(),
+			nodes: new(nodeRegistry),
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}, nil
+}
+
+// HTTPAddr - address http api listens at, port is known after Start
+func (s *Server) HTTPAddr() string {
+	return s.rs.cfg.HTTPAddr
+}
+
+// RaftAddr - raft address and id of node, port is known after Start
+func (s *Server) RaftAddr() string {
+	return s.rs.cfg.RaftAddr
+}
+
+// Start - listen http, start raft node and join cluster if JoinAddr is set, returns without blocking
+func (s *Server) Start() (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.started {
+		return errors.New("server already started")
+	}
+	s.started = true
+
+	rs := s.rs
+	ctx := &raftContext{rs: rs}
+
+	s.listener, err = net.Listen("tcp", rs.cfg.HTTPAddr)
+	if err != nil {
+		close(s.stop)
+		return fmt.Errorf("listen %s failed: %v", rs.cfg.HTTPAddr, err)
+	}
+	rs.cfg.HTTPAddr = s.listener.Addr().String()
+	log.Printf("http server listen:%s", rs.cfg.HTTPAddr)
+
+	logger := log.New(os.Stderr, "[httpServer]", log.Ldate|log.Ltime)
+	rs.hService = newHttpServer(ctx, logger)
+	s.http = &http.Server{Handler: rs.hService.mux, ErrorLog: logger}
+	go s.http.Serve(s.listener)
+
+	if rs.node, err = newRaftNode(rs.cfg, ctx); err != nil {
+		close(s.stop)
+		s.http.Close()
+		return fmt.Errorf("new raft node failed:%v", err)
+	}
+
+	go s.monitorLeadership()
+
+	if rs.cfg.JoinAddr != "" {
+		if err = joinRaftCluster(rs.cfg); err != nil {
+			s.shutdown(context.Background())
+			return fmt.Errorf("join raft cluster failed:%v", err)
+		}
+	}
+
+	return nil
+}
+
+// Shutdown - stop accepting writes, wait in-flight requests until ctx is done,
+// transfer leadership if TransferLeadership, then shutdown raft and close its stores.
+// raft is shut down even if ctx is done before requests finish
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.started {
+		return nil
+	}
+
+	select {
+	case <-s.stop:
+		return nil
+	default:
+	}
+
+	return s.shutdown(ctx)
+}
+
+func (s *Server) shutdown(ctx context.Context) error {
+	rs := s.rs
+	rs.hService.close()
+
+	// 等待处理中的请求, 写请求需要 raft 完成
+	err := s.http.Shutdown(ctx)
+	if err != nil {
+		log.Printf("http server shutdown:%v", err)
+	}
+
+	close(s.stop)
+	<-s.done
+
+	if rs.cfg.TransferLeadership && rs.node.raft.State() == raft.Leader {
+		if terr := rs.node.raft.LeadershipTransfer().Error(); terr != nil {
+			// 其他节点选举超时后选出新 leader
+			log.Printf("leadership transfer failed:%v", terr)
+		}
+	}
+
+	if cerr := rs.node.close(); cerr != nil && err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// monitorLeadership - leader 才开放写 api 和删除过期 key
+func (s *Server) monitorLeadership() {
+	defer close(s.done)
+
+	rs := s.rs
+	var stopReap chan struct{}
+	defer func() {
+		if stopReap != nil {
+			close(stopReap)
+		}
+	}()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case leader := <-rs.node.leaderNotifyChan:
+			if leader {
+				log.Println("become leader, enable write api")
+				rs.hService.setWriteFlag(true)
+				go rs.advertise()
+				if stopReap == nil {
+					stopReap = make(chan struct{})
+					go rs.reap(stopReap)
+				}
+			} else {
+				log.Println("become follower, close write api")
+				rs.hService.setWriteFlag(false)
+				if stopReap != nil {
+					close(stopReap)
+					stopReap = nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package raft
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft-boltdb"
+)
+
+// waitFor - wait until fn returns true, fail after 10s
+func waitFor(t *testing.T, what string, fn func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// tcp transport and bolt stores
+	c := &testCluster{t: t, dir: dir}
+	defer c.shutdown()
+	leader := c.add(true)
+	if err = leader.server.Start(); err == nil {
+		t.Fatal("want error of starting twice")
+	}
+
+	c.set(c.waitLeader(), "a", "1")
+	follower := c.add(false)
+	c.waitValue("a", "1")
+
+	// written on follower, forwarded to leader
+	c.set(follower, "b", "2")
+	if _, v := c.do(leader, http.MethodGet, "/get?key=b&consistency=linearizable"); v != "2" {
+		t.Fatalf("want b=2 on leader, got %q", v)
+	}
+
+	c.kill(follower)
+	if code, _ := c.do(follower, http.MethodGet, "/get?key=a"); code != 0 {
+		t.Fatalf("want http server closed, got %d", code)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &testCluster{t: t, dir: dir}
+	defer c.shutdown()
+	leader := c.addConfig(Config{Bootstrap: true, TransferLeadership: true})
+	c.set(c.waitLeader(), "a", "1")
+	follower := c.add(false)
+	c.waitValue("a", "1")
+
+	term := follower.rs().stats().Term
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = leader.server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = leader.server.Shutdown(ctx); err != nil {
+		t.Fatalf("want shutdown twice ok, got %v", err)
+	}
+	leader.up = false
+
+	// follower starts election at once, without waiting heartbeat timeout of 1s
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for follower.rs().stats().Term <= term {
+		if time.Now().After(deadline) {
+			t.Fatal("want leadership transferred to follower")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// bolt store is locked until closed
+	opened := make(chan error, 1)
+	go func() {
+		store, err := raftboltdb.NewBoltStore(filepath.Join(leader.dir, "raft-log.bolt"))
+		if err == nil {
+			err = store.Close()
+		}
+		opened <- err
+	}()
+	select {
+	case err = <-opened:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("want log store closed by shutdown")
+	}
+}
+
+func TestNewServerInvalid(t *testing.T) {
+	for _, cfg := range []*Config{
+		{HTTPAddr: "127.0.0.1:0", RaftAddr: "127.0.0.1:0"},
+		{DataDir: "node1", RaftAddr: "127.0.0.1:0"},
+		{DataDir: "node1", HTTPAddr: "127.0.0.1:0", RaftAddr: "127.0.0.1:0", Bootstrap: true, JoinAddr: "127.0.0.1:6000"},
+		{DataDir: "node1", HTTPAddr: "127.0.0.1:0", RaftAddr: "127.0.0.1:0", Forward: "tunnel"},
+	} {
+		if _, err := NewServer(cfg); err == nil {
+			t.Fatalf("want error of config %+v", cfg)
+		}
+	}
+}
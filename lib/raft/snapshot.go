@@ -1,20 +1,29 @@
 package raft
 
-import "github.com/hashicorp/raft"
+import (
+	"encoding/json"
 
+	"github.com/hashicorp/raft"
+)
+
+// snapshot - snapshotData marshaled by FSM.Snapshot
 type snapshot struct {
-	cm *cacheManager
+	data []byte
+}
+
+// snapshotFormat - format of snapshotData, snapshot of old version is cache only
+const snapshotFormat = 2
+
+type snapshotData struct {
+	Format int               `json:"format"`
+	Index  uint64            `json:"index"`
+	Cache  json.RawMessage   `json:"cache"`
+	Nodes  map[string]string `json:"nodes"`
 }
 
 // Persist saves the FSM snapshot out to the given sink.
 func (s *snapshot) Persist(sink raft.SnapshotSink) error {
-	snapshotBytes, err := s.cm.Marshal()
-	if err != nil {
-		sink.Cancel()
-		return err
-	}
-
-	if _, err = sink.Write(snapshotBytes); err != nil {
+	if _, err := sink.Write(s.data); err != nil {
 		sink.Cancel()
 		return err
 	}
@@ -4,7 +4,11 @@
 
 package klynlog
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // Logger provide leveled log
 type Logger interface {
@@ -57,3 +61,31 @@ func (l Level) String() string {
 		return fmt.Sprint(uint8(l))
 	}
 }
+
+// ParseLevel - parse level name (case insensitive) returned by Level.String,
+// "all" and "0" are level zero which logs everything
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "all":
+		return 0, nil
+	case "trace":
+		return LoggerLevelTrace, nil
+	case "debug":
+		return LoggerLevelDebug, nil
+	case "info":
+		return LoggerLevelInfo, nil
+	case "warn", "warning":
+		return LoggerLevelWarn, nil
+	case "error":
+		return LoggerLevelError, nil
+	case "fatal":
+		return LoggerLevelFatal, nil
+	}
+
+	// custom level logged by Any is written as number
+	if n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 8); err == nil {
+		return Level(n), nil
+	}
+
+	return 0, fmt.Errorf("klynlog: unknown level %q", s)
+}
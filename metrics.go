@@ -0,0 +1,93 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"sync/atomic"
+)
+
+// Metrics - receives measurements of logging pipeline, labels are pairs of name and value.
+// PrometheusMetrics implements it, others like statsd can be plugged in by LoggerConfig.Metrics
+type Metrics interface {
+	// Counter - add v to counter name
+	Counter(name string, v float64, labels ...string)
+	// Gauge - set gauge name to v
+	Gauge(name string, v float64, labels ...string)
+	// Histogram - observe v in histogram name
+	Histogram(name string, v float64, labels ...string)
+}
+
+// metrics of logging pipeline, all labeled by prefix of logger
+const (
+	// by level
+	metricRecords = "klyn_records_total"
+	// by reason: sampled, redact or encode
+	metricDropped = "klyn_dropped_records_total"
+	// by sink: file, spool, net or http, and target: log directory, spool path, addr or host of url
+	metricWrittenBytes = "klyn_written_bytes_total"
+	metricWriteErrors  = "klyn_write_errors_total"
+	metricSinkErrors   = "klyn_sink_errors_total"
+	metricFlushSeconds = "klyn_flush_duration_seconds"
+	metricCacheBytes   = "klyn_cache_bytes"
+)
+
+var metricHelp = map[string]string{
+	metricRecords:      "Records logged after level and sampling.",
+	metricDropped:      "Records discarded by sampling, or failed to redact or encode.",
+	metricWrittenBytes: "Bytes written into log file and sent by sinks.",
+	metricWriteErrors:  "Failed writes of log file and spool, and sends of sinks.",
+	metricSinkErrors:   "Failed deliveries of records to sinks.",
+	metricFlushSeconds: "Time to write cache into log file and sinks.",
+	metricCacheBytes:   "Bytes cached and not flushed yet.",
+}
+
+// instrumentedSink - sink reporting what it sends, metrics are set by logger it is added to
+type instrumentedSink interface {
+	instrument(m Metrics, prefix string)
+}
+
+// instrumentSinks - let sinks of c report into metrics of c, they stop reporting if it is nil
+func instrumentSinks(c *LoggerConfig) {
+	for _, sink := range c.Sinks {
+		if is, ok := sink.(instrumentedSink); ok {
+			is.instrument(c.Metrics, c.Prefix)
+		}
+	}
+}
+
+// sinkMeter - metrics and labels of a sink, replaced atomically as sink sends in background
+type sinkMeter struct {
+	v atomic.Value // *meterTarget
+}
+
+type meterTarget struct {
+	metrics Metrics
+	labels  []string
+}
+
+func (sm *sinkMeter) set(m Metrics, labels ...string) {
+	sm.v.Store(&meterTarget{metrics: m, labels: labels})
+}
+
+func (sm *sinkMeter) target() *meterTarget {
+	t, _ := sm.v.Load().(*meterTarget)
+	if t == nil || t.metrics == nil {
+		return nil
+	}
+
+	return t
+}
+
+func (sm *sinkMeter) written(bytes int) {
+	if t := sm.target(); t != nil {
+		t.metrics.Counter(metricWrittenBytes, float64(bytes), t.labels...)
+	}
+}
+
+func (sm *sinkMeter) failed() {
+	if t := sm.target(); t != nil {
+		t.metrics.Counter(metricWriteErrors, 1, t.labels...)
+	}
+}
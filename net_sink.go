@@ -0,0 +1,376 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Framing - how records are separated on the wire
+type Framing int
+
+const (
+	// FramingNewline - each record ends with '\n', as encoders write it
+	FramingNewline Framing = iota
+	// FramingLengthPrefix - each record is preceded by its length in 4 bytes big endian, without trailing '\n'
+	FramingLengthPrefix
+	// FramingOctetCounting - each record is preceded by its length in decimal and a space,
+	// without trailing '\n', as syslog over tcp in RFC 6587
+	FramingOctetCounting
+)
+
+const (
+	defaultNetSpoolSize    = 4 << 20 // 4M
+	defaultNetTimeout      = 5 * time.Second
+	defaultNetMinBackoff   = 100 * time.Millisecond
+	defaultNetMaxBackoff   = 30 * time.Second
+	defaultNetCloseTimeout = 5 * time.Second
+
+	maxNetBatch = 64 << 10 // max bytes sent by one write over tcp
+)
+
+// NetSinkConfig - net sink config
+type NetSinkConfig struct {
+	Network string      // tcp, udp, unix or unixgram
+	Addr    string      // host:port of collector, or path of unix socket
+	TLS     *tls.Config // dial with tls if not nil, tcp only
+
+	Framing Framing
+	Encoder Encoder // JSONEncoder if nil
+
+	// SpoolSize - max bytes held in memory while collector can not be reached,
+	// new records are dropped when spool is full. 4M if zero.
+	SpoolSize int
+
+	DialTimeout  time.Duration // 5s if zero
+	WriteTimeout time.Duration // 5s if zero
+	MinBackoff   time.Duration // first reconnect delay, doubled every failure. 100ms if zero
+	MaxBackoff   time.Duration // 30s if zero
+	CloseTimeout time.Duration // max time Close waits for spool to be sent. 5s if zero
+}
+
+// NetSink - ship records to a remote collector over tcp or udp.
+// records are spooled and sent by a background goroutine, which reconnects with exponential backoff.
+type NetSink struct {
+	conf *NetSinkConfig
+
+	lock    sync.Mutex
+	cond    *sync.Cond
+	spool   [][]byte
+	spooled int
+	closed  bool
+
+	dropped uint64
+	meter   sinkMeter
+	stop    chan struct{} // closed when close timeout reached
+	done    chan struct{} // closed when background goroutine exits
+	conn    net.Conn
+}
+
+// NewNetSink - get net sink and start sending in background, collector is connected lazily
+func NewNetSink(conf *NetSinkConfig) (*NetSink, error) {
+	c := *conf
+	switch c.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	case "udp", "udp4", "udp6", "unixgram":
+		if c.TLS != nil {
+			return nil, fmt.Errorf("klynlog: tls is not supported over %s", c.Network)
+		}
+	default:
+		return nil, fmt.Errorf("klynlog: unsupported network %q", c.Network)
+	}
+
+	if c.Addr == "" {
+		return nil, errors.New("klynlog: net sink addr is empty")
+	}
+
+	if c.Encoder == nil {
+		c.Encoder = JSONEncoder{}
+	}
+
+	setDefaultInt(&c.SpoolSize, defaultNetSpoolSize)
+	setDefaultDuration(&c.DialTimeout, defaultNetTimeout)
+	setDefaultDuration(&c.WriteTimeout, defaultNetTimeout)
+	setDefaultDuration(&c.MinBackoff, defaultNetMinBackoff)
+	setDefaultDuration(&c.MaxBackoff, defaultNetMaxBackoff)
+	setDefaultDuration(&c.CloseTimeout, defaultNetCloseTimeout)
+
+	ns := &NetSink{
+		conf: &c,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	ns.cond = sync.NewCond(&ns.lock)
+
+	go ns.run()
+	return ns, nil
+}
+
+// Write - implement Sink, encode entries into spool
+func (ns *NetSink) Write(entries []*Entry) error {
+	frames := make([][]byte, 0, len(entries))
+	for _, e := range entries {
+		line, err := ns.conf.Encoder.Encode(e)
+		if err != nil {
+			return err
+		}
+
+		frames = append(frames, ns.frame(line))
+	}
+
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+
+	if ns.closed {
+		return errors.New("klynlog: net sink closed")
+	}
+
+	for _, f := range frames {
+		if ns.spooled+len(f) > ns.conf.SpoolSize {
+			atomic.AddUint64(&ns.dropped, 1)
+			continue
+		}
+
+		ns.spool = append(ns.spool, f)
+		ns.spooled += len(f)
+	}
+
+	ns.cond.Signal()
+	return nil
+}
+
+// Dropped - number of records dropped as spool was full, or never able to be sent
+func (ns *NetSink) Dropped() uint64 {
+	return atomic.LoadUint64(&ns.dropped)
+}
+
+func (ns *NetSink) instrument(m Metrics, prefix string) {
+	ns.meter.set(m, "prefix", prefix, "sink", "net", "target", ns.conf.Addr)
+}
+
+// Close - implement Sink, wait spooled records to be sent until CloseTimeout
+func (ns *NetSink) Close() error {
+	ns.lock.Lock()
+	if ns.closed {
+		ns.lock.Unlock()
+		return nil
+	}
+	ns.closed = true
+	ns.cond.Signal()
+	ns.lock.Unlock()
+
+	select {
+	case <-ns.done:
+	case <-time.After(ns.conf.CloseTimeout):
+		close(ns.stop)
+		<-ns.done
+	}
+
+	ns.lock.Lock()
+	left := len(ns.spool)
+	ns.lock.Unlock()
+
+	if left > 0 {
+		return fmt.Errorf("klynlog: net sink closed with %d records not sent", left)
+	}
+
+	return nil
+}
+
+func (ns *NetSink) frame(line []byte) []byte {
+	if ns.conf.Framing == FramingNewline {
+		return line
+	}
+
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+
+	if ns.conf.Framing == FramingOctetCounting {
+		return append([]byte(strconv.Itoa(len(line))+" "), line...)
+	}
+
+	f := make([]byte, 4+len(line))
+	binary.BigEndian.PutUint32(f, uint32(len(line)))
+	copy(f[4:], line)
+	return f
+}
+
+// run - send spooled frames, frames are removed from spool only after sent or found unsendable
+func (ns *NetSink) run() {
+	defer close(ns.done)
+	defer ns.closeConn()
+
+	backoff := ns.conf.MinBackoff
+	for {
+		b, n, ok := ns.head()
+		if !ok {
+			return
+		}
+
+		if err := ns.send(b); err != nil {
+			ns.meter.failed()
+			if ns.unsendable(err) {
+				// retry would fail forever and block every later record
+				atomic.AddUint64(&ns.dropped, uint64(n))
+				ns.pop(n, len(b))
+				continue
+			}
+
+			ns.closeConn()
+			select {
+			case <-ns.stop:
+				return
+			case <-time.After(backoff):
+			}
+
+			if backoff *= 2; backoff > ns.conf.MaxBackoff {
+				backoff = ns.conf.MaxBackoff
+			}
+			continue
+		}
+
+		backoff = ns.conf.MinBackoff
+		ns.meter.written(len(b))
+		ns.pop(n, len(b))
+	}
+}
+
+// head - wait for frames at head of spool, false if closed and spool is empty.
+// over tcp frames are joined up to maxNetBatch bytes, over udp every frame is a datagram.
+func (ns *NetSink) head() (b []byte, n int, ok bool) {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+
+	for len(ns.spool) == 0 {
+		if ns.closed {
+			return nil, 0, false
+		}
+
+		ns.cond.Wait()
+	}
+
+	if ns.isPacket() {
+		return ns.spool[0], 1, true
+	}
+
+	for _, f := range ns.spool {
+		if n > 0 && len(b)+len(f) > maxNetBatch {
+			break
+		}
+
+		b = append(b, f...)
+		n++
+	}
+
+	return b, n, true
+}
+
+func (ns *NetSink) pop(n, size int) {
+	ns.lock.Lock()
+	for i := 0; i < n; i++ {
+		ns.spool[i] = nil
+	}
+	ns.spool = ns.spool[n:]
+	ns.spooled -= size
+	ns.lock.Unlock()
+}
+
+func (ns *NetSink) isPacket() bool {
+	switch ns.conf.Network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	default:
+		return false
+	}
+}
+
+// unsendable - whether err of sending frames means they can never be sent,
+// like a datagram larger than udp or unixgram allows
+func (ns *NetSink) unsendable(err error) bool {
+	return ns.isPacket() && errors.Is(err, syscall.EMSGSIZE)
+}
+
+func (ns *NetSink) send(f []byte) (err error) {
+	if ns.conn != nil && !ns.alive() {
+		ns.closeConn()
+	}
+
+	if ns.conn == nil {
+		if ns.conn, err = ns.dial(); err != nil {
+			return
+		}
+	}
+
+	if err = ns.conn.SetWriteDeadline(time.Now().Add(ns.conf.WriteTimeout)); err != nil {
+		return
+	}
+
+	_, err = ns.conn.Write(f)
+	return
+}
+
+func (ns *NetSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: ns.conf.DialTimeout}
+	if ns.conf.TLS != nil {
+		return tls.DialWithDialer(dialer, ns.conf.Network, ns.conf.Addr, ns.conf.TLS)
+	}
+
+	return dialer.Dial(ns.conf.Network, ns.conf.Addr)
+}
+
+// alive - check whether collector closed connection, write to a closed connection
+// may still succeed once, and the records would be lost without reconnecting.
+// collector never sends, so reading EOF or error other than EAGAIN means closed.
+func (ns *NetSink) alive() bool {
+	sc, ok := ns.conn.(syscall.Conn)
+	if !ok {
+		return true
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	alive := true
+	err = raw.Read(func(fd uintptr) bool {
+		var b [1]byte
+		n, rerr := syscall.Read(int(fd), b[:])
+		alive = n > 0 || rerr == syscall.EAGAIN || rerr == syscall.EWOULDBLOCK
+		// never wait for readable
+		return true
+	})
+
+	return err == nil && alive
+}
+
+func (ns *NetSink) closeConn() {
+	if ns.conn != nil {
+		_ = ns.conn.Close()
+		ns.conn = nil
+	}
+}
+
+func setDefaultInt(v *int, def int) {
+	if *v <= 0 {
+		*v = def
+	}
+}
+
+func setDefaultDuration(v *time.Duration, def time.Duration) {
+	if *v <= 0 {
+		*v = def
+	}
+}
@@ -0,0 +1,308 @@
+package klynlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+func testEntries(from, to int) []*Entry {
+	var entries []*Entry
+	for i := from; i < to; i++ {
+		entries = append(entries, &Entry{
+			Prefix: "KLYN",
+			Time:   time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC),
+			Level:  LoggerLevelInfo,
+			Data:   map[string]interface{}{"userId": i},
+		})
+	}
+
+	return entries
+}
+
+func wantLine(i int) string {
+	return fmt.Sprintf(`{"prefix":"KLYN","time":"2018-06-01T10:00:00.000Z","level":"info","message":{"userId":%d}}`, i)
+}
+
+// readLines - accept connections of l one after another, send every line read to returned channel.
+// stop closes l and connection being read.
+func readLines(t *testing.T, l net.Listener) (lines <-chan string, stop func()) {
+	ch := make(chan string, 100)
+	conns := make(chan net.Conn, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			select {
+			case <-conns:
+			default:
+			}
+			conns <- conn
+
+			s := bufio.NewScanner(conn)
+			for s.Scan() {
+				ch <- s.Text()
+			}
+			conn.Close()
+		}
+	}()
+
+	return ch, func() {
+		l.Close()
+		select {
+		case conn := <-conns:
+			conn.Close()
+		default:
+		}
+	}
+}
+
+func expectLines(t *testing.T, lines <-chan string, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		select {
+		case line := <-lines:
+			if line != wantLine(i) {
+				t.Fatalf("want %s, got %s", wantLine(i), line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting line %d", i)
+		}
+	}
+}
+
+func TestNetSinkTCPReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+
+	sink, err := NewNetSink(&NetSinkConfig{Network: "tcp", Addr: addr, MinBackoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines, stop := readLines(t, l)
+	if err = sink.Write(testEntries(0, 3)); err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, lines, 0, 3)
+
+	// collector goes away, records are spooled until it is back
+	stop()
+	time.Sleep(50 * time.Millisecond)
+	if err = sink.Write(testEntries(3, 6)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if l, err = net.Listen("tcp", addr); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, stop = readLines(t, l)
+	defer stop()
+
+	expectLines(t, lines, 3, 6)
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetSinkLengthPrefix(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	sink, err := NewNetSink(&NetSinkConfig{Network: "tcp", Addr: l.Addr().String(), Framing: FramingLengthPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err = sink.Write(testEntries(0, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < 2; i++ {
+		var size uint32
+		if err = binary.Read(conn, binary.BigEndian, &size); err != nil {
+			t.Fatal(err)
+		}
+
+		b := make([]byte, size)
+		if _, err = io.ReadFull(conn, b); err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != wantLine(i) {
+			t.Fatalf("want %s, got %s", wantLine(i), b)
+		}
+	}
+}
+
+func TestNetSinkUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	sink, err := NewNetSink(&NetSinkConfig{Network: "udp", Addr: pc.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err = sink.Write(testEntries(0, 3)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64*1024)
+	for i := 0; i < 3; i++ {
+		_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// one record per datagram
+		if got := strings.TrimSuffix(string(buf[:n]), "\n"); got != wantLine(i) {
+			t.Fatalf("want %s, got %s", wantLine(i), got)
+		}
+	}
+}
+
+func TestNetSinkUDPOversized(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	sink, err := NewNetSink(&NetSinkConfig{Network: "udp", Addr: pc.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	// larger than any udp datagram, fails with EMSGSIZE
+	big := &Entry{Prefix: "KLYN", Level: LoggerLevelInfo, Data: strings.Repeat("x", 70000)}
+	if err = sink.Write(append([]*Entry{big}, testEntries(0, 1)...)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64*1024)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.TrimSuffix(string(buf[:n]), "\n"); got != wantLine(0) {
+		t.Fatalf("want %s, got %s", wantLine(0), got)
+	}
+
+	if sink.Dropped() != 1 {
+		t.Fatalf("want 1 dropped, got %d", sink.Dropped())
+	}
+}
+
+func TestNetSinkSpoolFull(t *testing.T) {
+	// reserve a port nobody listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	size := len(wantLine(0)) + 1
+	sink, err := NewNetSink(&NetSinkConfig{
+		Network:      "tcp",
+		Addr:         addr,
+		SpoolSize:    size * 3,
+		MinBackoff:   10 * time.Millisecond,
+		CloseTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = sink.Write(testEntries(0, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	if sink.Dropped() != 2 {
+		t.Fatalf("want 2 dropped, got %d", sink.Dropped())
+	}
+
+	if err = sink.Close(); err == nil || !strings.Contains(err.Error(), "3 records not sent") {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+
+	if err = sink.Write(testEntries(0, 1)); err == nil {
+		t.Fatal("want error writing to closed sink")
+	}
+}
+
+func TestLoggerWithNetSink(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := NewNetSink(&NetSinkConfig{Network: "tcp", Addr: l.Addr().String(), Encoder: TextEncoder{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := fmt.Sprintf("netsink%d", time.Now().UnixNano())
+	logger := NewLogger(&LoggerConfig{
+		Prefix:    prefix,
+		FlushMode: consts.FlushModeByDuration,
+		Sinks:     []Sink{sink},
+	}).(*KlynLog)
+	defer os.Remove(fmt.Sprintf("%s/%s-%s.log", consts.DefaultLogDir, prefix, time.Now().Format(consts.LogFileDateFormat)))
+
+	payload := map[string]interface{}{"userId": 1}
+	logger.Warn(payload)
+	// changed after logged, sink still gets what was logged
+	payload["userId"] = 2
+
+	lines, stop := readLines(t, l)
+	defer stop()
+
+	select {
+	case line := <-lines:
+		if !strings.HasPrefix(line, "["+prefix+"] | TIME:") || !strings.HasSuffix(line, ` | LEVEL:warn | message:{"userId":1}`) {
+			t.Fatalf("unexpected line %s", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting line")
+	}
+
+	if err = logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
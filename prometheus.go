@@ -0,0 +1,234 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets - upper bounds in seconds of histograms, fit flushes of cache
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// PrometheusMetrics - Metrics kept in memory and served in prometheus text exposition format,
+// no prometheus client library or push gateway is needed:
+//
+//	pm := klog.NewPrometheusMetrics()
+//	mux.Handle("/metrics", pm)
+//	logger := klog.NewLogger(&klog.LoggerConfig{Prefix: "KLYN", Metrics: pm})
+//
+// a name is of the type it is first used as, uses as other types are ignored.
+type PrometheusMetrics struct {
+	buckets []float64
+
+	lock     sync.Mutex
+	families map[string]*promFamily
+}
+
+type promFamily struct {
+	typ    string                 // counter, gauge or histogram
+	series map[string]*promSeries // by rendered labels
+}
+
+type promSeries struct {
+	labels []string
+	value  float64  // counter and gauge
+	counts []uint64 // histogram, per bucket and not cumulative, last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheusMetrics - metrics of histograms with upper bounds buckets, DefaultBuckets if none
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+
+	return &PrometheusMetrics{buckets: b, families: make(map[string]*promFamily)}
+}
+
+// Counter - implement Metrics
+func (pm *PrometheusMetrics) Counter(name string, v float64, labels ...string) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	if s := pm.series(name, "counter", labels); s != nil && v > 0 {
+		s.value += v
+	}
+}
+
+// Gauge - implement Metrics
+func (pm *PrometheusMetrics) Gauge(name string, v float64, labels ...string) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	if s := pm.series(name, "gauge", labels); s != nil {
+		s.value = v
+	}
+}
+
+// Histogram - implement Metrics
+func (pm *PrometheusMetrics) Histogram(name string, v float64, labels ...string) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	s := pm.series(name, "histogram", labels)
+	if s == nil {
+		return
+	}
+
+	if s.counts == nil {
+		s.counts = make([]uint64, len(pm.buckets)+1)
+	}
+
+	// first bucket whose upper bound is not less than v, +Inf if none
+	s.counts[sort.SearchFloat64s(pm.buckets, v)]++
+	s.sum += v
+	s.count++
+}
+
+// series - series of name and labels, created if not yet. nil if name is of other type
+func (pm *PrometheusMetrics) series(name, typ string, labels []string) *promSeries {
+	f, ok := pm.families[name]
+	if !ok {
+		f = &promFamily{typ: typ, series: make(map[string]*promSeries)}
+		pm.families[name] = f
+	}
+
+	if f.typ != typ {
+		return nil
+	}
+
+	if len(labels)%2 != 0 {
+		labels = labels[:len(labels)-1]
+	}
+
+	key := renderLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &promSeries{labels: append([]string(nil), labels...)}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// WriteTo - write all metrics in prometheus text exposition format 0.0.4, sorted by name and labels
+func (pm *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	buf := new(bytes.Buffer)
+
+	pm.lock.Lock()
+	names := make([]string, 0, len(pm.families))
+	for name := range pm.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := pm.families[name]
+		if help, ok := metricHelp[name]; ok {
+			fmt.Fprintf(buf, "# HELP %s %s\n", name, escapeHelp(help))
+		}
+		fmt.Fprintf(buf, "# TYPE %s %s\n", name, f.typ)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			if f.typ != "histogram" {
+				fmt.Fprintf(buf, "%s%s %s\n", name, key, formatFloat(s.value))
+				continue
+			}
+
+			var cumulative uint64
+			for i, n := range s.counts {
+				le := math.Inf(1)
+				if i < len(pm.buckets) {
+					le = pm.buckets[i]
+				}
+
+				cumulative += n
+				fmt.Fprintf(buf, "%s_bucket%s %d\n", name, renderLabels(append(s.labels[:len(s.labels):len(s.labels)], "le", formatFloat(le))), cumulative)
+			}
+			fmt.Fprintf(buf, "%s_sum%s %s\n", name, key, formatFloat(s.sum))
+			fmt.Fprintf(buf, "%s_count%s %d\n", name, key, s.count)
+		}
+	}
+	pm.lock.Unlock()
+
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP - serve metrics to prometheus scraper
+func (pm *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if r.Method == http.MethodGet {
+		_, _ = pm.WriteTo(w)
+	}
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// renderLabels - {name="value",...} of pairs, empty if none
+func renderLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	b := new(bytes.Buffer)
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
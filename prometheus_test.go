@@ -0,0 +1,148 @@
+package klynlog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+func TestPrometheusExposition(t *testing.T) {
+	pm := NewPrometheusMetrics(5, 1)
+
+	pm.Counter("requests_total", 1, "path", `/a"b\c`+"\n")
+	pm.Counter("requests_total", 2, "path", `/a"b\c`+"\n")
+	pm.Counter("requests_total", 1)
+	pm.Counter("requests_total", -1) // counters never go down
+	pm.Gauge("requests_total", 10)   // used as counter first
+	pm.Gauge(metricCacheBytes, 3, "prefix", "KLYN")
+	pm.Gauge(metricCacheBytes, 2, "prefix", "KLYN")
+	for _, v := range []float64{0.5, 1, 3, 10} {
+		pm.Histogram("latency_seconds", v, "prefix", "KLYN", "odd")
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := pm.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP klyn_cache_bytes Bytes cached and not flushed yet.
+# TYPE klyn_cache_bytes gauge
+klyn_cache_bytes{prefix="KLYN"} 2
+# TYPE latency_seconds histogram
+latency_seconds_bucket{prefix="KLYN",le="1"} 2
+latency_seconds_bucket{prefix="KLYN",le="5"} 3
+latency_seconds_bucket{prefix="KLYN",le="+Inf"} 4
+latency_seconds_sum{prefix="KLYN"} 14.5
+latency_seconds_count{prefix="KLYN"} 4
+# TYPE requests_total counter
+requests_total 1
+requests_total{path="/a\"b\\c\n"} 3
+`
+	if buf.String() != want {
+		t.Fatalf("want:\n%s\ngot:\n%s", want, buf)
+	}
+}
+
+// scrapeValue - value of series line starting with series, empty if not found
+func scrapeValue(body, series string) string {
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, series+" ") {
+			return strings.TrimPrefix(line, series+" ")
+		}
+	}
+
+	return ""
+}
+
+func TestPrometheusScrape(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newCollector()
+	collector := httptest.NewServer(c)
+	defer collector.Close()
+
+	sink, err := NewHTTPSink(&HTTPSinkConfig{URL: collector.URL + "/push", BatchSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm := NewPrometheusMetrics()
+	server := httptest.NewServer(pm)
+	defer server.Close()
+
+	logger := NewLogger(&LoggerConfig{
+		Prefix:    "KLYN",
+		Dir:       dir,
+		FlushMode: consts.FlushModeBySize,
+		Level:     LoggerLevelInfo,
+		Sampling:  &Sampling{Initial: 2},
+		Sinks:     []Sink{sink},
+		Metrics:   pm,
+	}).(*KlynLog)
+	defer logger.Close()
+
+	logger.Debug("discarded by level")
+	for i := 0; i < 3; i++ {
+		logger.Info(i)
+	}
+	logger.Error("failed")
+	if err = logger.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	c.wait(t, 3)
+
+	u, _ := url.Parse(collector.URL)
+	var body string
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if ct := resp.Header.Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+			t.Fatalf("unexpected content type %s", ct)
+		}
+
+		// bytes of http sink are counted once its posts returned
+		body = string(b)
+		if scrapeValue(body, `klyn_written_bytes_total{prefix="KLYN",sink="http",target="`+u.Host+`"}`) != "" ||
+			time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for series, want := range map[string]string{
+		`klyn_records_total{prefix="KLYN",level="info"}`:                              "2",
+		`klyn_records_total{prefix="KLYN",level="error"}`:                             "1",
+		`klyn_dropped_records_total{prefix="KLYN",reason="sampled"}`:                  "1",
+		`klyn_flush_duration_seconds_count{prefix="KLYN"}`:                            "1",
+		`klyn_written_bytes_total{prefix="KLYN",sink="file",target="` + dir + `"}`:    `\d+`,
+		`klyn_written_bytes_total{prefix="KLYN",sink="http",target="` + u.Host + `"}`: `\d+`,
+		`klyn_cache_bytes{prefix="KLYN"}`:                                             `\d+`,
+	} {
+		got := scrapeValue(body, series)
+		if !regexp.MustCompile(`^` + want + `$`).MatchString(got) {
+			t.Fatalf("want %s %s, got %q in:\n%s", series, want, got, body)
+		}
+	}
+
+	if s := logger.Stats(); s.Written != 3 || s.Dropped != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
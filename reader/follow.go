@@ -0,0 +1,238 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package reader
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultPollInterval - how often Follower checks files for new lines
+const DefaultPollInterval = 200 * time.Millisecond
+
+// Position - offset in a log file
+type Position struct {
+	File   LogFile
+	Offset int64
+}
+
+// Follower - follow records appended to files of a prefix like `tail -f`,
+// switch to file of next day once it is created.
+type Follower struct {
+	dir    string
+	prefix string
+	query  Query
+
+	// PollInterval - interval of checking new lines, DefaultPollInterval if zero
+	PollInterval time.Duration
+
+	cur     LogFile
+	file    *os.File
+	br      *bufio.Reader
+	offset  int64
+	partial []byte
+	rec     *Record
+	err     error
+}
+
+// Follow - follow files of prefix under dir from pos.
+// nil pos means end of newest file, so only records logged from now on are returned.
+func Follow(dir, prefix string, q Query, pos *Position) (*Follower, error) {
+	f := &Follower{dir: dir, prefix: prefix, query: q}
+	if pos != nil {
+		f.cur, f.offset = pos.File, pos.Offset
+		return f, nil
+	}
+
+	files, err := Files(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) > 0 {
+		f.cur = files[len(files)-1]
+		info, err := os.Stat(f.cur.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		f.offset = info.Size()
+	}
+
+	return f, nil
+}
+
+// Next - wait for next matched record, return false if ctx done or error occurred
+func (f *Follower) Next(ctx context.Context) bool {
+	if f.err != nil {
+		return false
+	}
+
+	interval := f.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	for {
+		rec, err := f.readRecord()
+		if err != nil {
+			f.err = err
+			return false
+		}
+
+		if rec != nil {
+			f.rec = rec
+			return true
+		}
+
+		// reached end of current file, move on only when newer file exists
+		switched, err := f.switchFile()
+		if err != nil {
+			f.err = err
+			return false
+		}
+
+		if switched {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Record - current record
+func (f *Follower) Record() *Record {
+	return f.rec
+}
+
+// Err - error stopped following
+func (f *Follower) Err() error {
+	return f.err
+}
+
+// Position - position after current record
+func (f *Follower) Position() Position {
+	return Position{File: f.cur, Offset: f.offset}
+}
+
+// Close - close current file
+func (f *Follower) Close() error {
+	f.br = nil
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// readRecord - read next matched record of current file, nil record if no complete line left
+func (f *Follower) readRecord() (*Record, error) {
+	if f.cur.Path == "" {
+		return nil, nil
+	}
+
+	if f.file == nil {
+		file, err := os.Open(f.cur.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		// file truncated since last read
+		if info, err := file.Stat(); err == nil && info.Size() < f.offset {
+			f.offset = 0
+		}
+
+		if _, err = file.Seek(f.offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		f.file = file
+		f.br = bufio.NewReaderSize(file, 64*1024)
+	}
+
+	for {
+		line, err := f.br.ReadBytes('\n')
+		if err == io.EOF {
+			// keep partial line until writer finishes it
+			f.partial = append(f.partial, line...)
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(f.partial) > 0 {
+			line = append(f.partial, line...)
+			f.partial = nil
+		}
+
+		f.offset += int64(len(line))
+		rec, perr := ParseLine(line)
+		if perr != nil {
+			continue
+		}
+
+		rec.File = f.cur.Path
+		if rec.Time.IsZero() {
+			rec.Time = f.cur.Day
+		}
+
+		if f.query.Match(rec) {
+			return rec, nil
+		}
+	}
+}
+
+// switchFile - switch to the oldest file newer than current one,
+// or to new file at current path once current one is rotated by size
+func (f *Follower) switchFile() (bool, error) {
+	if f.file != nil {
+		opened, err := f.file.Stat()
+		if err != nil {
+			return false, err
+		}
+
+		// file read to end was renamed, new one is written at its path
+		if cur, err := os.Stat(f.cur.Path); err == nil && !os.SameFile(opened, cur) {
+			if err = f.Close(); err != nil {
+				return false, err
+			}
+
+			f.offset, f.partial = 0, nil
+			return true, nil
+		}
+	}
+
+	files, err := Files(f.dir, f.prefix)
+	if err != nil {
+		return false, err
+	}
+
+	for _, file := range files {
+		if file.Seq != 0 || (f.cur.Path != "" && !file.Day.After(f.cur.Day)) {
+			continue
+		}
+
+		if err = f.Close(); err != nil {
+			return false, err
+		}
+
+		f.cur, f.offset, f.partial = file, 0, nil
+		return true, nil
+	}
+
+	return false, nil
+}
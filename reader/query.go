@@ -0,0 +1,110 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package reader
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	klynlog "github.com/yusank/klyn-log"
+)
+
+// Predicate - report whether record should be returned
+type Predicate func(r *Record) bool
+
+// Query - filter of records, zero value matches everything
+type Query struct {
+	Since time.Time // inclusive
+	Until time.Time // exclusive
+
+	MinLevel klynlog.Level   // records below MinLevel are skipped
+	Levels   []klynlog.Level // only these levels if not empty
+
+	Where []Predicate // all predicates must match
+}
+
+// Match - report whether r matches q
+func (q *Query) Match(r *Record) bool {
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+
+	if !q.Until.IsZero() && !r.Time.Before(q.Until) {
+		return false
+	}
+
+	if r.Level < q.MinLevel {
+		return false
+	}
+
+	if len(q.Levels) > 0 && !containsLevel(q.Levels, r.Level) {
+		return false
+	}
+
+	for _, p := range q.Where {
+		if !p(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchDay - report whether any record of file with day may match q
+func (q *Query) matchDay(day time.Time) bool {
+	if !q.Since.IsZero() && !day.AddDate(0, 0, 1).After(q.Since) {
+		return false
+	}
+
+	if !q.Until.IsZero() && !day.Before(q.Until) {
+		return false
+	}
+
+	return true
+}
+
+func containsLevel(levels []klynlog.Level, l klynlog.Level) bool {
+	for _, v := range levels {
+		if v == l {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FieldExists - field at dotted path is present
+func FieldExists(path string) Predicate {
+	return func(r *Record) bool {
+		_, ok := r.Field(path)
+		return ok
+	}
+}
+
+// FieldEquals - field at dotted path equals value.
+// values are compared by their printed form, so 1234 matches "1234"
+func FieldEquals(path string, value interface{}) Predicate {
+	want := fmt.Sprint(value)
+	return func(r *Record) bool {
+		v, ok := r.Field(path)
+		return ok && fmt.Sprint(v) == want
+	}
+}
+
+// FieldMatches - printed form of field at dotted path matches re
+func FieldMatches(path string, re *regexp.Regexp) Predicate {
+	return func(r *Record) bool {
+		v, ok := r.Field(path)
+		return ok && re.MatchString(fmt.Sprint(v))
+	}
+}
+
+// Not - negate predicate
+func Not(p Predicate) Predicate {
+	return func(r *Record) bool {
+		return !p(r)
+	}
+}
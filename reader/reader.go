@@ -0,0 +1,210 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package reader reads back log files written by KlynLog.
+// Records are streamed line by line, so files of any size can be read.
+package reader
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+// LogFile - a dated log file of a prefix
+type LogFile struct {
+	Path string
+	Day  time.Time // local midnight of the day file written
+	Seq  int       // N of PREFIX-2006-01-02.N.log rotated by size, 0 for file being written
+}
+
+// Files - list log files of prefix under dir, oldest first
+func Files(dir, prefix string) ([]LogFile, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []LogFile
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+
+		day, seq, ok := parseFileName(info.Name(), prefix)
+		if !ok {
+			continue
+		}
+
+		files = append(files, LogFile{Path: filepath.Join(dir, info.Name()), Day: day, Seq: seq})
+	}
+
+	// files rotated of a day are older than the one being written
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].Day.Equal(files[j].Day) {
+			return files[i].Day.Before(files[j].Day)
+		}
+
+		return files[j].Seq == 0 || (files[i].Seq != 0 && files[i].Seq < files[j].Seq)
+	})
+
+	return files, nil
+}
+
+// parseFileName - parse file name like PREFIX-2006-01-02.log, or PREFIX-2006-01-02.N.log rotated by size
+func parseFileName(name, prefix string) (day time.Time, seq int, ok bool) {
+	if !strings.HasPrefix(name, prefix+"-") || !strings.HasSuffix(name, ".log") {
+		return
+	}
+
+	date := strings.TrimSuffix(strings.TrimPrefix(name, prefix+"-"), ".log")
+	if i := strings.IndexByte(date, '.'); i >= 0 {
+		n, err := strconv.Atoi(date[i+1:])
+		if err != nil || n <= 0 {
+			return
+		}
+		date, seq = date[:i], n
+	}
+
+	day, err := time.ParseInLocation(consts.LogFileDateFormat, date, time.Local)
+	if err != nil {
+		return
+	}
+
+	return day, seq, true
+}
+
+// Reader - iterate records of all files of a prefix
+//
+//	r, err := reader.Open("logFiles", "KLYN", reader.Query{MinLevel: klynlog.LoggerLevelWarn})
+//	if err != nil {
+//		return err
+//	}
+//	defer r.Close()
+//
+//	for r.Next() {
+//		rec := r.Record()
+//	}
+//	return r.Err()
+type Reader struct {
+	query Query
+	files []LogFile
+
+	cur    LogFile
+	file   *os.File
+	br     *bufio.Reader
+	lineNo int
+	rec    *Record
+	err    error
+}
+
+// Open - open reader of files of prefix under dir, files out of query time range are never opened
+func Open(dir, prefix string, q Query) (*Reader, error) {
+	files, err := Files(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{query: q}
+	for _, f := range files {
+		if q.matchDay(f.Day) {
+			r.files = append(r.files, f)
+		}
+	}
+
+	return r, nil
+}
+
+// Next - advance to next matched record, return false when no more record or error occurred
+func (r *Reader) Next() bool {
+	if r.err != nil {
+		return false
+	}
+
+	for {
+		if r.br == nil && !r.openNext() {
+			return false
+		}
+
+		line, err := r.br.ReadBytes('\n')
+		if len(line) > 0 {
+			r.lineNo++
+			if rec, perr := ParseLine(line); perr == nil {
+				rec.File = r.cur.Path
+				rec.Line = r.lineNo
+				if rec.Time.IsZero() {
+					rec.Time = r.cur.Day
+				}
+
+				if r.query.Match(rec) {
+					r.rec = rec
+					return true
+				}
+			}
+		}
+
+		if err == io.EOF {
+			r.closeFile()
+			continue
+		}
+
+		if err != nil {
+			r.err = err
+			return false
+		}
+	}
+}
+
+// Record - current record, valid until next call of Next
+func (r *Reader) Record() *Record {
+	return r.rec
+}
+
+// Err - first error met while reading
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Close - close current file
+func (r *Reader) Close() error {
+	r.files = nil
+	return r.closeFile()
+}
+
+func (r *Reader) openNext() bool {
+	if len(r.files) == 0 {
+		return false
+	}
+
+	r.cur, r.files = r.files[0], r.files[1:]
+	f, err := os.Open(r.cur.Path)
+	if err != nil {
+		r.err = err
+		return false
+	}
+
+	r.file = f
+	r.br = bufio.NewReaderSize(f, 64*1024)
+	r.lineNo = 0
+	return true
+}
+
+func (r *Reader) closeFile() error {
+	r.br = nil
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,331 @@
+package reader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	klynlog "github.com/yusank/klyn-log"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	rec, err := ParseLine([]byte(`[KLYN] | TIME:2018-06-01T10:00:00.000+08:00 | LEVEL:warn | message:{"a":"x | y","event":{"gameId":"dddjs"}}` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Prefix != "KLYN" || rec.Level != klynlog.LoggerLevelWarn {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+
+	if !rec.Time.Equal(time.Date(2018, 6, 1, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected time %v", rec.Time)
+	}
+
+	if v, ok := rec.Field("event.gameId"); !ok || v != "dddjs" {
+		t.Fatalf("unexpected field %v", v)
+	}
+
+	if v, _ := rec.Field("a"); v != "x | y" {
+		t.Fatalf("unexpected field %v", v)
+	}
+
+	// written before TIME was added
+	rec, err = ParseLine([]byte(`[KLYN] | LEVEL:error | message:"plain"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rec.Time.IsZero() || rec.Level != klynlog.LoggerLevelError || rec.Fields() != nil {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+
+	for _, line := range []string{"", "2018/06/01 10:00:00 [KLYN] | LEVEL:warn", "[KLYN] | message:{}"} {
+		if _, err = ParseLine([]byte(line)); err == nil {
+			t.Fatalf("expect error for %q", line)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, dir, "KLYN-2018-06-02.log",
+		`[KLYN] | TIME:2018-06-02T08:00:00.000Z | LEVEL:info | message:{"userId":3}`+"\n"+
+			`[KLYN] | TIME:2018-06-02T09:00:00.000Z | LEVEL:error | message:{"userId":4}`+"\n")
+	writeFile(t, dir, "KLYN-2018-06-01.log",
+		`[KLYN] | TIME:2018-06-01T08:00:00.000Z | LEVEL:warn | message:{"userId":1}`+"\n"+
+			"not a log line\n"+
+			`[KLYN] | TIME:2018-06-01T09:00:00.000Z | LEVEL:debug | message:{"userId":2}`)
+	writeFile(t, dir, "OTHER-2018-06-01.log", `[OTHER] | LEVEL:fatal | message:{"userId":5}`+"\n")
+
+	read := func(q Query) (ids []int) {
+		r, err := Open(dir, "KLYN", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		for r.Next() {
+			var v struct{ UserID int }
+			if err = r.Record().Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+
+			ids = append(ids, v.UserID)
+		}
+
+		if err = r.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	cases := []struct {
+		name  string
+		query Query
+		want  []int
+	}{
+		{"all", Query{}, []int{1, 2, 3, 4}},
+		{"min level", Query{MinLevel: klynlog.LoggerLevelWarn}, []int{1, 4}},
+		{"levels", Query{Levels: []klynlog.Level{klynlog.LoggerLevelDebug, klynlog.LoggerLevelInfo}}, []int{2, 3}},
+		{"time range", Query{
+			Since: time.Date(2018, 6, 1, 9, 0, 0, 0, time.UTC),
+			Until: time.Date(2018, 6, 2, 9, 0, 0, 0, time.UTC),
+		}, []int{2, 3}},
+		{"field", Query{Where: []Predicate{FieldEquals("userId", 3)}}, []int{3}},
+		{"not field", Query{Where: []Predicate{Not(FieldEquals("userId", 3)), FieldExists("userId")}}, []int{1, 2, 4}},
+	}
+
+	for _, c := range cases {
+		got := read(c.query)
+		if len(got) != len(c.want) {
+			t.Fatalf("%s: want %v, got %v", c.name, c.want, got)
+		}
+
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Fatalf("%s: want %v, got %v", c.name, c.want, got)
+			}
+		}
+	}
+}
+
+func TestParseLineFormats(t *testing.T) {
+	e := &klynlog.Entry{
+		Prefix: "KLYN",
+		Time:   time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC),
+		Level:  klynlog.LoggerLevelWarn,
+		Data: map[string]interface{}{
+			"name":   "hello world",
+			"userId": 1234,
+			"code":   "007",
+			"event":  map[string]interface{}{"gameId": "dddjs"},
+		},
+	}
+
+	for _, name := range []string{"text", "json", "logfmt"} {
+		enc, err := klynlog.NewEncoder(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line, err := enc.Encode(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec, err := ParseLine(line)
+		if err != nil {
+			t.Fatalf("%s: %v, line: %s", name, err, line)
+		}
+
+		if rec.Prefix != e.Prefix || rec.Level != e.Level || !rec.Time.Equal(e.Time) {
+			t.Fatalf("%s: unexpected record %+v", name, rec)
+		}
+
+		var v struct {
+			Name   string
+			UserID int
+			Code   string
+			Event  struct{ GameID string }
+		}
+		if err = rec.Decode(&v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if v.Name != "hello world" || v.UserID != 1234 || v.Code != "007" || v.Event.GameID != "dddjs" {
+			t.Fatalf("%s: unexpected message %s", name, rec.Message)
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, dir, "KLYN-2018-06-01.log", `[KLYN] | LEVEL:info | message:{"userId":1}`+"\n")
+
+	f, err := Follow(dir, "KLYN", Query{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.PollInterval = 10 * time.Millisecond
+
+	appendLine := func(name, line string) {
+		file, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		if _, err = file.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		// partial line is held until it is finished
+		appendLine("KLYN-2018-06-01.log", `[KLYN] | LEVEL:info | mess`)
+		time.Sleep(50 * time.Millisecond)
+		appendLine("KLYN-2018-06-01.log", `age:{"userId":2}`+"\n")
+		time.Sleep(50 * time.Millisecond)
+		appendLine("KLYN-2018-06-02.log", `[KLYN] | LEVEL:info | message:{"userId":3}`+"\n")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, want := range []int{2, 3} {
+		if !f.Next(ctx) {
+			t.Fatalf("want %d, got err: %v", want, f.Err())
+		}
+
+		if v, _ := f.Record().Field("userId"); fmt.Sprint(v) != fmt.Sprint(want) {
+			t.Fatalf("want %d, got %v", want, v)
+		}
+	}
+}
+
+func TestRotatedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-rotated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"KLYN-2018-06-02.log", "KLYN-2018-06-01.log", "KLYN-2018-06-01.10.log",
+		"KLYN-2018-06-01.2.log", "KLYN-2018-06-01.x.log", "KLYN-2018-06-01.0.log"} {
+		writeFile(t, dir, name, "")
+	}
+
+	files, err := Files(dir, "KLYN")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f.Path))
+	}
+
+	want := "[KLYN-2018-06-01.2.log KLYN-2018-06-01.10.log KLYN-2018-06-01.log KLYN-2018-06-02.log]"
+	if fmt.Sprint(names) != want {
+		t.Fatalf("want %s, got %v", want, names)
+	}
+}
+
+func TestFollowRotated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	active := filepath.Join(dir, "KLYN-2018-06-01.log")
+	writeFile(t, dir, "KLYN-2018-06-01.log", "")
+
+	f, err := Follow(dir, "KLYN", Query{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.PollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	writeFile(t, dir, "KLYN-2018-06-01.log", `[KLYN] | LEVEL:info | message:{"userId":1}`+"\n")
+	if !f.Next(ctx) {
+		t.Fatal(f.Err())
+	}
+
+	// written before rotation but not read yet, then rotated by size
+	file, err := os.OpenFile(active, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.WriteString(`[KLYN] | LEVEL:info | message:{"userId":2}` + "\n")
+	file.Close()
+
+	if err = os.Rename(active, filepath.Join(dir, "KLYN-2018-06-01.1.log")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "KLYN-2018-06-01.log", `[KLYN] | LEVEL:info | message:{"userId":3}`+"\n")
+
+	for _, want := range []int{2, 3} {
+		if !f.Next(ctx) {
+			t.Fatalf("want %d, got err: %v", want, f.Err())
+		}
+
+		if v, _ := f.Record().Field("userId"); fmt.Sprint(v) != fmt.Sprint(want) {
+			t.Fatalf("want %d, got %v", want, v)
+		}
+	}
+}
+
+func TestRecordEntry(t *testing.T) {
+	rec, err := ParseLine([]byte(`[KLYN] | TIME:2018-06-01T10:00:00.000+08:00 | LEVEL:warn | message:{"id":9007199254740993}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := rec.Entry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := klynlog.JSONEncoder{}.Encode(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(line), `9007199254740993`) {
+		t.Fatalf("want id kept, got %s", line)
+	}
+
+	rec = &Record{Message: []byte(`{"id":`), File: "KLYN.log", Line: 3}
+	if _, err = rec.Entry(); err == nil {
+		t.Fatal("want error of malformed message")
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package reader
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	klynlog "github.com/yusank/klyn-log"
+	"github.com/yusank/klyn-log/consts"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.Config{
+	EscapeHTML:             true,
+	SortMapKeys:            true,
+	UseNumber:              true,
+	ValidateJsonRawMessage: true,
+}.Froze()
+
+// ErrMalformedLine - line is not written by KlynLog
+var ErrMalformedLine = errors.New("reader: malformed log line")
+
+// Record - a single log line read back from file
+type Record struct {
+	Prefix  string
+	Time    time.Time // date of file at midnight when line carries no TIME
+	Level   klynlog.Level
+	Message jsoniter.RawMessage // message json as logged
+
+	File string // file record read from
+	Line int    // line number in File, start from 1
+
+	fields  map[string]interface{}
+	decoded bool
+}
+
+// Decode - decode message into v
+func (r *Record) Decode(v interface{}) error {
+	return json.Unmarshal(r.Message, v)
+}
+
+// Fields - message decoded as json object, nil if message is not an object
+func (r *Record) Fields() map[string]interface{} {
+	if !r.decoded {
+		var v interface{}
+		_ = json.Unmarshal(r.Message, &v)
+		r.fields, _ = v.(map[string]interface{})
+		r.decoded = true
+	}
+
+	return r.fields
+}
+
+// Field - get field by dotted path like "event.gameId"
+func (r *Record) Field(path string) (v interface{}, ok bool) {
+	var cur interface{} = r.Fields()
+	for _, key := range strings.Split(path, ".") {
+		m, isMap := cur.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+// Entry - convert record to klynlog.Entry, so it can be encoded again.
+// numbers are kept as json.Number, so large ids are not rounded
+func (r *Record) Entry() (*klynlog.Entry, error) {
+	var data interface{}
+	dec := stdjson.NewDecoder(bytes.NewReader(r.Message))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return nil, fmt.Errorf("reader: decode message of %s:%d: %v", r.File, r.Line, err)
+	}
+
+	return &klynlog.Entry{
+		Prefix: r.Prefix,
+		Time:   r.Time,
+		Level:  r.Level,
+		Data:   data,
+	}, nil
+}
+
+// ParseLine - parse line written by any of klynlog encoders.
+// line starts with '[' is text, '{' is json, otherwise logfmt.
+func ParseLine(line []byte) (*Record, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, ErrMalformedLine
+	}
+
+	switch line[0] {
+	case '[':
+		return parseText(line)
+	case '{':
+		return parseJSON(line)
+	default:
+		return parseLogfmt(line)
+	}
+}
+
+// parseText - parse line like:
+// [PREFIX] | TIME:2006-01-02T15:04:05.000Z07:00 | LEVEL:warn | message:{...}
+// TIME is optional as older files were written without it.
+func parseText(line []byte) (*Record, error) {
+	end := bytes.Index(line, []byte("] | "))
+	if end < 0 {
+		return nil, ErrMalformedLine
+	}
+
+	rec := &Record{Prefix: string(line[1:end])}
+	rest := line[end+len("] | "):]
+	for {
+		// message is always the last segment and may contain separator itself
+		if bytes.HasPrefix(rest, []byte("message:")) {
+			rec.Message = append(jsoniter.RawMessage(nil), rest[len("message:"):]...)
+			break
+		}
+
+		sep := bytes.Index(rest, []byte(" | "))
+		if sep < 0 {
+			return nil, ErrMalformedLine
+		}
+
+		if err := rec.setSegment(string(rest[:sep])); err != nil {
+			return nil, err
+		}
+
+		rest = rest[sep+len(" | "):]
+	}
+
+	if rec.Level == 0 || !stdjson.Valid(rec.Message) {
+		return nil, ErrMalformedLine
+	}
+
+	return rec, nil
+}
+
+func (r *Record) setSegment(seg string) error {
+	i := strings.IndexByte(seg, ':')
+	if i < 0 {
+		return ErrMalformedLine
+	}
+
+	// unknown segments are ignored so newer files stay readable
+	return r.setHeader(strings.ToLower(seg[:i]), seg[i+1:])
+}
+
+func (r *Record) setHeader(key, val string) (err error) {
+	switch key {
+	case "prefix":
+		r.Prefix = val
+	case "time":
+		if r.Time, err = time.Parse(consts.LogTimeFormat, val); err != nil {
+			return fmt.Errorf("reader: parse time: %v", err)
+		}
+	case "level":
+		if r.Level, err = klynlog.ParseLevel(val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseJSON - parse line written by klynlog.JSONEncoder
+func parseJSON(line []byte) (*Record, error) {
+	var v struct {
+		Prefix  string              `json:"prefix"`
+		Time    string              `json:"time"`
+		Level   string              `json:"level"`
+		Message jsoniter.RawMessage `json:"message"`
+	}
+
+	if err := json.Unmarshal(line, &v); err != nil || v.Level == "" {
+		return nil, ErrMalformedLine
+	}
+
+	rec := &Record{Prefix: v.Prefix, Message: v.Message}
+	if v.Time != "" {
+		if err := rec.setHeader("time", v.Time); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rec.setHeader("level", v.Level); err != nil {
+		return nil, err
+	}
+
+	if len(rec.Message) == 0 {
+		rec.Message = jsoniter.RawMessage("null")
+	}
+
+	return rec, nil
+}
+
+// parseLogfmt - parse line written by klynlog.LogfmtEncoder,
+// dotted keys are unflattened into nested objects.
+func parseLogfmt(line []byte) (*Record, error) {
+	pairs, err := splitLogfmt(string(line))
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Record{}
+	fields := make(map[string]interface{})
+	for i, p := range pairs {
+		// header is always the leading prefix, time and level pairs
+		if i < 3 && (p.key == "prefix" || p.key == "time" || p.key == "level") {
+			if err = rec.setHeader(p.key, p.val); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		setPath(fields, strings.Split(p.key, "."), p.value())
+	}
+
+	if rec.Level == 0 {
+		return nil, ErrMalformedLine
+	}
+
+	var data interface{} = fields
+	if msg, ok := fields["message"]; ok && len(fields) == 1 {
+		// payload was not an object
+		data = msg
+	}
+
+	if rec.Message, err = json.Marshal(data); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+type logfmtPair struct {
+	key    string
+	val    string
+	quoted bool
+}
+
+// value - quoted value is always string, others are read as json literal if possible
+func (p logfmtPair) value() interface{} {
+	if p.quoted {
+		return p.val
+	}
+
+	var v interface{}
+	if !stdjson.Valid([]byte(p.val)) || json.Unmarshal([]byte(p.val), &v) != nil {
+		return p.val
+	}
+
+	return v
+}
+
+func splitLogfmt(s string) (pairs []logfmtPair, err error) {
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || strings.IndexByte(s[:eq], ' ') >= 0 {
+			return nil, ErrMalformedLine
+		}
+
+		p := logfmtPair{key: s[:eq]}
+		s = s[eq+1:]
+		if strings.HasPrefix(s, "\"") {
+			quoted, qerr := strconv.QuotedPrefix(s)
+			if qerr != nil {
+				return nil, ErrMalformedLine
+			}
+
+			p.val, _ = strconv.Unquote(quoted)
+			p.quoted = true
+			s = s[len(quoted):]
+		} else {
+			end := strings.IndexByte(s, ' ')
+			if end < 0 {
+				end = len(s)
+			}
+
+			p.val, s = s[:end], s[end:]
+		}
+
+		pairs = append(pairs, p)
+	}
+}
+
+func setPath(m map[string]interface{}, path []string, v interface{}) {
+	for _, key := range path[:len(path)-1] {
+		sub, ok := m[key].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			m[key] = sub
+		}
+
+		m = sub
+	}
+
+	m[path[len(path)-1]] = v
+}
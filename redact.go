@@ -0,0 +1,173 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	stdjson "encoding/json"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultMask - replacement of redacted values
+const DefaultMask = "******"
+
+// Redactor - rewrite payload before it is encoded.
+// v is json decoded copy of payload, one of map[string]interface{}, []interface{},
+// string, json.Number, bool or nil, so it is safe to modify in place.
+type Redactor interface {
+	Redact(v interface{}) interface{}
+}
+
+// RedactorFunc - func as Redactor
+type RedactorFunc func(v interface{}) interface{}
+
+// Redact - call f
+func (f RedactorFunc) Redact(v interface{}) interface{} {
+	return f(v)
+}
+
+// KeyRedactor - mask or drop fields by key.
+// Keys are case insensitive path.Match patterns, pattern with dot is matched against
+// dotted path of field like "user.token", pattern without dot against key at any depth.
+type KeyRedactor struct {
+	Keys []string
+	Mask string // DefaultMask if empty
+	Drop bool   // drop field instead of masking it
+}
+
+// Redact - implement Redactor
+func (kr *KeyRedactor) Redact(v interface{}) interface{} {
+	return kr.walk(v, "")
+}
+
+func (kr *KeyRedactor) walk(v interface{}, prefix string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, sub := range val {
+			p := prefix + k
+			if kr.match(k, p) {
+				if kr.Drop {
+					delete(val, k)
+				} else {
+					val[k] = kr.mask()
+				}
+				continue
+			}
+
+			val[k] = kr.walk(sub, p+".")
+		}
+	case []interface{}:
+		// elements share path of array
+		for i := range val {
+			val[i] = kr.walk(val[i], prefix)
+		}
+	}
+
+	return v
+}
+
+func (kr *KeyRedactor) match(key, fullPath string) bool {
+	key, fullPath = strings.ToLower(key), strings.ToLower(fullPath)
+	for _, pattern := range kr.Keys {
+		pattern = strings.ToLower(pattern)
+		name := key
+		if strings.Contains(pattern, ".") {
+			name = fullPath
+		}
+
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (kr *KeyRedactor) mask() string {
+	if kr.Mask == "" {
+		return DefaultMask
+	}
+
+	return kr.Mask
+}
+
+// ValueRedactor - replace matches of Pattern in every string value and printed form of
+// every number, keys are left as is. a number matched becomes a string.
+type ValueRedactor struct {
+	Pattern     *regexp.Regexp
+	Replacement string // DefaultMask if empty, may refer submatch like ${1}
+	Erase       bool   // remove matches, Replacement is ignored
+}
+
+// Redact - implement Redactor
+func (vr *ValueRedactor) Redact(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return vr.Pattern.ReplaceAllString(val, vr.replacement())
+	case stdjson.Number:
+		if s := val.String(); vr.Pattern.MatchString(s) {
+			return vr.Pattern.ReplaceAllString(s, vr.replacement())
+		}
+	case map[string]interface{}:
+		for k, sub := range val {
+			val[k] = vr.Redact(sub)
+		}
+	case []interface{}:
+		for i := range val {
+			val[i] = vr.Redact(val[i])
+		}
+	}
+
+	return v
+}
+
+func (vr *ValueRedactor) replacement() string {
+	if vr.Erase {
+		return ""
+	}
+
+	if vr.Replacement == "" {
+		return DefaultMask
+	}
+
+	return vr.Replacement
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`\+?\d[\d\- ]{7,}\d`)
+	tokenPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`)
+)
+
+// EmailRedactor - mask email addresses in string values
+func EmailRedactor() Redactor {
+	return &ValueRedactor{Pattern: emailPattern}
+}
+
+// PhoneRedactor - mask phone numbers, which are digits with optional leading + and - or space between,
+// in string values and numbers
+func PhoneRedactor() Redactor {
+	return &ValueRedactor{Pattern: phonePattern}
+}
+
+// BearerTokenRedactor - mask token of "Bearer <token>" in string values
+func BearerTokenRedactor() Redactor {
+	return &ValueRedactor{Pattern: tokenPattern, Replacement: "${1}" + DefaultMask}
+}
+
+// redact - apply redactors on a json copy of payload, caller's payload is never modified
+func redact(redactors []Redactor, j interface{}) (interface{}, error) {
+	v, err := jsonValue(j)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range redactors {
+		v = r.Redact(v)
+	}
+
+	return v, nil
+}
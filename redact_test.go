@@ -0,0 +1,136 @@
+package klynlog
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+func TestKeyRedactor(t *testing.T) {
+	payload := map[string]interface{}{
+		"Token": "t-1",
+		"user": map[string]interface{}{
+			"name":     "yusank",
+			"password": "p-1",
+			"session":  map[string]interface{}{"id": "s-1"},
+		},
+		"items": []interface{}{map[string]interface{}{"password": "p-2"}},
+	}
+
+	cases := []struct {
+		redactor Redactor
+		want     string
+	}{
+		{&KeyRedactor{Keys: []string{"token", "password"}},
+			`{"Token":"******","items":[{"password":"******"}],"user":{"name":"yusank","password":"******","session":{"id":"s-1"}}}`},
+		{&KeyRedactor{Keys: []string{"user.session", "items"}, Drop: true},
+			`{"Token":"t-1","user":{"name":"yusank","password":"p-1"}}`},
+		{&KeyRedactor{Keys: []string{"user.*"}, Mask: "x"},
+			`{"Token":"t-1","items":[{"password":"p-2"}],"user":{"name":"x","password":"x","session":"x"}}`},
+	}
+
+	for _, c := range cases {
+		v, err := redact([]Redactor{c.redactor}, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, _ := json.Marshal(v)
+		if string(b) != c.want {
+			t.Fatalf("want %s, got %s", c.want, b)
+		}
+	}
+
+	// payload of caller is untouched
+	if payload["Token"] != "t-1" || payload["user"].(map[string]interface{})["password"] != "p-1" {
+		t.Fatalf("payload modified: %v", payload)
+	}
+}
+
+func TestValueRedactor(t *testing.T) {
+	payload := struct {
+		Msg    string   `json:"msg"`
+		Auth   string   `json:"auth"`
+		Phones []string `json:"phones"`
+		Count  int      `json:"count"`
+		Phone  int      `json:"phone"`
+		Card   string   `json:"card"`
+	}{
+		Msg:    "mail to yusank@example.com please",
+		Auth:   "Bearer abc.def-123",
+		Phones: []string{"+86 138-0013-8000"},
+		Count:  123,
+		Phone:  13800138000,
+		Card:   "card-1234 paid",
+	}
+
+	v, err := redact([]Redactor{
+		EmailRedactor(),
+		PhoneRedactor(),
+		BearerTokenRedactor(),
+		&ValueRedactor{Pattern: regexp.MustCompile(`please`), Replacement: "thanks"},
+		&ValueRedactor{Pattern: regexp.MustCompile(`card-\d+ `), Erase: true},
+	}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := json.Marshal(v)
+	// number matched is masked as string, others are kept as number
+	want := `{"auth":"Bearer ******","card":"paid","count":123,"msg":"mail to ****** thanks","phone":"******","phones":["******"]}`
+	if string(b) != want {
+		t.Fatalf("want %s, got %s", want, b)
+	}
+}
+
+func TestRedactBeforeSink(t *testing.T) {
+	secrets := []string{"s3cr3t-token", "yusank@example.com", "hunter2"}
+
+	debugOut := new(bytes.Buffer)
+	log.SetOutput(debugOut)
+	defer log.SetOutput(os.Stderr)
+
+	prefix := fmt.Sprintf("redact%d", time.Now().UnixNano())
+	logger := NewLogger(&LoggerConfig{
+		Prefix:    prefix,
+		FlushMode: consts.FlushModeEveryLog,
+		IsDebug:   true,
+		Redactors: []Redactor{
+			&KeyRedactor{Keys: []string{"token", "password"}},
+			EmailRedactor(),
+		},
+	})
+
+	fileName := fmt.Sprintf("%s/%s-%s.log", consts.DefaultLogDir, prefix, time.Now().Format(consts.LogFileDateFormat))
+	defer os.Remove(fileName)
+
+	for _, level := range []Level{LoggerLevelInfo, LoggerLevelError} {
+		logger.Any(level, map[string]interface{}{
+			"token": secrets[0],
+			"user":  map[string]interface{}{"email": "contact " + secrets[1], "password": secrets[2]},
+		})
+	}
+
+	written, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Count(string(written), "\n") != 2 || strings.Count(debugOut.String(), "\n") != 2 {
+		t.Fatalf("unexpected output, file:\n%s\ndebug:\n%s", written, debugOut)
+	}
+
+	for _, secret := range secrets {
+		if bytes.Contains(written, []byte(secret)) || strings.Contains(debugOut.String(), secret) {
+			t.Fatalf("secret %q leaked, file:\n%s\ndebug:\n%s", secret, written, debugOut)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+var (
+	registryLock  sync.RWMutex
+	named         = make(map[string]Logger)
+	defaultLogger Logger
+
+	// loggers created by NewLogger and not closed yet, flushed on signal
+	liveLock    sync.Mutex
+	liveLoggers = make(map[*KlynLog]struct{})
+	signalOnce  sync.Once
+)
+
+// Register - register logger under name, replace the one registered before
+func Register(name string, l Logger) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	named[name] = l
+}
+
+// Unregister - remove logger registered under name, it is not closed
+func Unregister(name string) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	delete(named, name)
+}
+
+// Lookup - logger registered under name
+func Lookup(name string) (Logger, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	l, ok := named[name]
+	return l, ok
+}
+
+// registered - copy of loggers registered by name
+func registered() map[string]Logger {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	m := make(map[string]Logger, len(named))
+	for name, l := range named {
+		m[name] = l
+	}
+
+	return m
+}
+
+// Get - logger registered under name. if none registered, a logger with name
+// in upper case as prefix, writing into its own dir under consts.DefaultLogDir,
+// is created and registered. use Lookup to check whether name is registered.
+// panic if name to create logger by contains path separator or "..", as its dir
+// would be out of consts.DefaultLogDir
+func Get(name string) Logger {
+	if l, ok := Lookup(name); ok {
+		return l
+	}
+
+	if strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		panic(fmt.Sprintf("klynlog: invalid logger name %q", name))
+	}
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if l, ok := named[name]; ok {
+		return l
+	}
+
+	l := NewLogger(&LoggerConfig{
+		Prefix:    strings.ToUpper(name),
+		Dir:       filepath.Join(consts.DefaultLogDir, name),
+		FlushMode: consts.FlushModeByDuration,
+	})
+	named[name] = l
+	return l
+}
+
+// Default - process-wide default logger, created by first call unless set by SetDefault
+func Default() Logger {
+	registryLock.RLock()
+	l := defaultLogger
+	registryLock.RUnlock()
+	if l != nil {
+		return l
+	}
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if defaultLogger == nil {
+		defaultLogger = NewLogger(&LoggerConfig{
+			Prefix:    "KLYN",
+			FlushMode: consts.FlushModeByDuration,
+			IsDebug:   true,
+		})
+	}
+
+	return defaultLogger
+}
+
+// SetDefault - replace default logger used by package-level log functions,
+// the one replaced is not closed
+func SetDefault(l Logger) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	defaultLogger = l
+}
+
+// Trace - trace level log by default logger
+func Trace(j interface{}) {
+	Default().Trace(j)
+}
+
+// Debug - debug level log by default logger
+func Debug(j interface{}) {
+	Default().Debug(j)
+}
+
+// Info - info level log by default logger
+func Info(j interface{}) {
+	Default().Info(j)
+}
+
+// Warn - warn level log by default logger
+func Warn(j interface{}) {
+	Default().Warn(j)
+}
+
+// Error - error level log by default logger
+func Error(j interface{}) {
+	Default().Error(j)
+}
+
+// Fatal - fatal level log by default logger
+func Fatal(j interface{}) {
+	Default().Fatal(j)
+}
+
+// Any - custom level log by default logger
+func Any(l Level, j interface{}) {
+	Default().Any(l, j)
+}
+
+// track - keep logger for signal handler, which is installed once for all loggers
+func track(kl *KlynLog) {
+	liveLock.Lock()
+	liveLoggers[kl] = struct{}{}
+	liveLock.Unlock()
+
+	signalOnce.Do(func() {
+		go handleSignals()
+	})
+}
+
+func untrack(kl *KlynLog) {
+	liveLock.Lock()
+	delete(liveLoggers, kl)
+	liveLock.Unlock()
+}
+
+func live() []*KlynLog {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+
+	loggers := make([]*KlynLog, 0, len(liveLoggers))
+	for kl := range liveLoggers {
+		loggers = append(loggers, kl)
+	}
+
+	return loggers
+}
+
+func handleSignals() {
+	c := make(chan os.Signal, 1)
+	// 监听信号量
+	// SIGHUP: 终端结束进程(终端连接断开)
+	// SIGTERM: 结束程序
+	// SIGINT: Ctrl+ c 操作
+	// SIGQUIT: Ctrl+ / 操作
+	// SIGUSR1, SIGUSR2 用户保留
+	signal.Notify(c, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT,
+		syscall.SIGUSR1, syscall.SIGUSR2)
+
+	for s := range c {
+		log.Println("catch signal:", s.String())
+		switch s {
+		// 如果为退出信号 则将所有日志写入文件后安全退出
+		case syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT:
+			// give sinks a chance to deliver what they hold
+			for _, kl := range live() {
+				_ = kl.Close()
+			}
+			os.Exit(0)
+		// 可以通过给进程发送 syscall.SIGUSR1, syscall.SIGUSR2 信号来，强制将缓存中的日志写入文件
+		default:
+			for _, kl := range live() {
+				_ = kl.syncAndFlushCache()
+			}
+		}
+	}
+}
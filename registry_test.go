@@ -0,0 +1,181 @@
+package klynlog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+// levelLogger - Logger keeping level of every call
+type levelLogger struct {
+	lock   sync.Mutex
+	levels []Level
+}
+
+func (ll *levelLogger) Trace(j interface{}) { ll.Any(LoggerLevelTrace, j) }
+func (ll *levelLogger) Debug(j interface{}) { ll.Any(LoggerLevelDebug, j) }
+func (ll *levelLogger) Info(j interface{})  { ll.Any(LoggerLevelInfo, j) }
+func (ll *levelLogger) Warn(j interface{})  { ll.Any(LoggerLevelWarn, j) }
+func (ll *levelLogger) Error(j interface{}) { ll.Any(LoggerLevelError, j) }
+func (ll *levelLogger) Fatal(j interface{}) { ll.Any(LoggerLevelFatal, j) }
+func (ll *levelLogger) OFF()                {}
+
+func (ll *levelLogger) Any(l Level, j interface{}) {
+	ll.lock.Lock()
+	ll.levels = append(ll.levels, l)
+	ll.lock.Unlock()
+}
+
+func TestRegistry(t *testing.T) {
+	audit := new(levelLogger)
+	Register("audit", audit)
+	defer Unregister("audit")
+
+	if l, ok := Lookup("audit"); !ok || l != audit {
+		t.Fatalf("want audit logger, got %v", l)
+	}
+
+	if Get("audit") != audit {
+		t.Fatal("want audit logger from Get")
+	}
+
+	if _, ok := Lookup("missing"); ok {
+		t.Fatal("want nothing registered as missing")
+	}
+
+	Unregister("audit")
+	if Get("audit") == audit {
+		t.Fatal("want unregistered logger not returned")
+	}
+}
+
+func TestGetUnknown(t *testing.T) {
+	def := new(levelLogger)
+	old := Default()
+	SetDefault(def)
+	defer SetDefault(old)
+
+	name := fmt.Sprintf("unknown%d", time.Now().UnixNano())
+	defer os.RemoveAll(filepath.Join(consts.DefaultLogDir, name))
+
+	l := Get(name)
+	defer Unregister(name)
+	defer l.(*KlynLog).Close()
+
+	// never falls back to default
+	if l == def {
+		t.Fatal("want a new logger for name not registered")
+	}
+	if registered, ok := Lookup(name); !ok || registered != l {
+		t.Fatal("want logger created by Get registered")
+	}
+	if Get(name) != l {
+		t.Fatal("want same logger from Get again")
+	}
+
+	kl := l.(*KlynLog)
+	if c := kl.conf(); c.Prefix != strings.ToUpper(name) || c.Dir != filepath.Join(consts.DefaultLogDir, name) {
+		t.Fatalf("unexpected config %+v", c)
+	}
+}
+
+func TestGetInvalidName(t *testing.T) {
+	for _, name := range []string{"../x", "a/b", `a\b`, ".."} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("want panic of name %q", name)
+				}
+			}()
+
+			Get(name)
+		}()
+
+		if _, ok := Lookup(name); ok {
+			t.Fatalf("want %q not registered", name)
+		}
+	}
+
+	// registered loggers are returned whatever their names are
+	l := new(levelLogger)
+	Register("a/b", l)
+	defer Unregister("a/b")
+	if Get("a/b") != l {
+		t.Fatal("want registered logger")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	if Default() != Default() || DefaultLogger() != Default() {
+		t.Fatal("want default logger created once")
+	}
+
+	def := new(levelLogger)
+	old := Default()
+	SetDefault(def)
+	defer SetDefault(old)
+
+	Trace(1)
+	Debug(1)
+	Info(1)
+	Warn(1)
+	Error(1)
+	Fatal(1)
+	Any(Level(100), 1)
+
+	want := []Level{LoggerLevelTrace, LoggerLevelDebug, LoggerLevelInfo, LoggerLevelWarn,
+		LoggerLevelError, LoggerLevelFatal, Level(100)}
+	if fmt.Sprint(def.levels) != fmt.Sprint(want) {
+		t.Fatalf("want %v, got %v", want, def.levels)
+	}
+}
+
+func TestIndependentLoggers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	day := time.Now().Format(consts.LogFileDateFormat)
+	var loggers []*KlynLog
+	for _, name := range []string{"audit", "access"} {
+		kl := NewLogger(&LoggerConfig{
+			Prefix:    name,
+			Dir:       filepath.Join(dir, name),
+			FlushMode: consts.FlushModeByDuration,
+		}).(*KlynLog)
+		loggers = append(loggers, kl)
+
+		kl.Info(name)
+	}
+
+	for i, name := range []string{"audit", "access"} {
+		if err = loggers[i].Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, name, name+"-"+day+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if lines := strings.Split(strings.TrimSpace(string(b)), "\n"); len(lines) != 1 || !strings.HasSuffix(lines[0], `message:"`+name+`"`) {
+			t.Fatalf("unexpected %s log:\n%s", name, b)
+		}
+	}
+
+	// closed loggers are not flushed on signal any more
+	for _, kl := range live() {
+		if kl == loggers[0] || kl == loggers[1] {
+			t.Fatal("closed logger still tracked")
+		}
+	}
+}
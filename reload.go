@@ -0,0 +1,261 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+	"github.com/yusank/klyn-log/utils"
+)
+
+// pipeline - config of logger and state derived from it, replaced as a whole
+// so log never sees half of an old config and half of a new one
+type pipeline struct {
+	config  *LoggerConfig
+	sampler *sampler // nil if config.Sampling is nil
+	source  *Config  // config converted into LoggerConfig, nil if given as LoggerConfig
+
+	// followDefault - level of default logger is used instead of config.Level, until level set
+	followDefault bool
+}
+
+func newPipeline(l *LoggerConfig, source *Config) *pipeline {
+	c := *l
+	p := &pipeline{config: &c, source: source}
+	if c.Sampling != nil {
+		p.sampler = newSampler(c.Sampling)
+	}
+
+	return p
+}
+
+var errLoggerClosed = errors.New("klynlog: logger closed")
+
+func (kl *KlynLog) load() *pipeline {
+	return kl.pipeline.Load().(*pipeline)
+}
+
+// conf - current config, must not be changed
+func (kl *KlynLog) conf() *LoggerConfig {
+	return kl.load().config
+}
+
+// Level - records below it are discarded
+func (kl *KlynLog) Level() Level {
+	return kl.levelOf(kl.load())
+}
+
+func (kl *KlynLog) levelOf(p *pipeline) Level {
+	if p.followDefault {
+		if d, ok := Default().(*KlynLog); ok && d != kl {
+			return d.Level()
+		}
+	}
+
+	return p.config.Level
+}
+
+// SetLevel - change level of running logger, nothing else of config is changed
+func (kl *KlynLog) SetLevel(l Level) {
+	kl.reloadLock.Lock()
+	defer kl.reloadLock.Unlock()
+
+	p := *kl.load()
+	c := *p.config
+	c.Level = l
+	p.config = &c
+	p.followDefault = false
+	kl.pipeline.Store(&p)
+}
+
+// followDefaultLevel - use level of default logger from now on, its later changes included,
+// until SetLevel or Reload
+func (kl *KlynLog) followDefaultLevel() {
+	kl.reloadLock.Lock()
+	defer kl.reloadLock.Unlock()
+
+	p := *kl.load()
+	p.followDefault = true
+	kl.pipeline.Store(&p)
+}
+
+// Reload - replace config of running logger. records cached so far are flushed into
+// log file and sinks of old config first, then level, sampling, flush mode, durability,
+// encoder, redactors, sinks, rotation, Prefix and Dir of lc take effect at once.
+// sinks of old config not in lc are closed, sinks are compared by ==.
+// SpoolPath can not be changed, and Hooks of lc are ignored, use AddHook instead.
+func (kl *KlynLog) Reload(lc *LoggerConfig) error {
+	kl.reloadLock.Lock()
+	defer kl.reloadLock.Unlock()
+
+	return kl.reloadLocked(lc, nil)
+}
+
+// ReloadConfig - convert c into LoggerConfig and Reload it. sinks of same config
+// as logger created or last reloaded by a Config are kept, others are created.
+// Metrics of logger is kept if c.Metrics is nil.
+func (kl *KlynLog) ReloadConfig(c *Config) error {
+	kl.reloadLock.Lock()
+	defer kl.reloadLock.Unlock()
+
+	old := kl.load()
+	lc, err := c.loggerConfig(old.source, old.config.Sinks)
+	if err != nil {
+		return err
+	}
+	if lc.Metrics == nil {
+		// can not be set by config file
+		lc.Metrics = old.config.Metrics
+	}
+
+	if err = kl.reloadLocked(lc, c); err != nil {
+		for _, sink := range lc.Sinks {
+			if !hasSink(old.config.Sinks, sink) {
+				_ = sink.Close()
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (kl *KlynLog) reloadLocked(lc *LoggerConfig, source *Config) error {
+	select {
+	case <-kl.done:
+		return errLoggerClosed
+	default:
+	}
+
+	old := kl.conf()
+	if lc.SpoolPath != old.SpoolPath {
+		return errors.New("klynlog: SpoolPath can not be reloaded")
+	}
+
+	if err := utils.CreateIfNotExist(dirOf(lc)); err != nil {
+		return err
+	}
+
+	if lc.SpoolPath != "" && lc.FlushMode != consts.FlushModeEveryLog && kl.cache.getSpool() == nil {
+		// created in FlushModeEveryLog, records are cached from now on
+		s, err := openSpool(lc.SpoolPath)
+		if err != nil {
+			return err
+		}
+
+		kl.cache.cacheLock.Lock()
+		kl.cache.spool = s
+		kl.cache.cacheLock.Unlock()
+	}
+
+	// records cached by old config go to its sinks. records cached while swapping are
+	// flushed by monitor later, in FlushModeEveryLog too. flushes in progress are waited,
+	// and those after see new config, so old sinks are not written once closed below
+	kl.flushLock.Lock()
+	if err := kl.flushLocked(); err != nil {
+		kl.flushLock.Unlock()
+		return err
+	}
+
+	kl.pipeline.Store(newPipeline(lc, source))
+	instrumentSinks(lc)
+
+	kl.logWriter.writerLock.Lock()
+	kl.logWriter.syncOnClose = lc.Durability != consts.DurabilityNone
+	kl.logWriter.writerLock.Unlock()
+	kl.flushLock.Unlock()
+
+	for _, sink := range old.Sinks {
+		if hasSink(lc.Sinks, sink) {
+			continue
+		}
+
+		if err := sink.Close(); err != nil {
+			log.Printf("klynlog: close sink failed:%v", err)
+		}
+	}
+
+	return nil
+}
+
+func hasSink(sinks []Sink, sink Sink) bool {
+	for _, s := range sinks {
+		if s == sink {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameSinkConfig - index of sink in old of same config as sc, -1 if none
+func sameSinkConfig(old []SinkConfig, used map[int]bool, sc *SinkConfig) int {
+	for i := range old {
+		if !used[i] && reflect.DeepEqual(&old[i], sc) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// WatchConfig - reload config file of path by ReloadConfig once its modification time
+// or size changes, checked every interval, consts.DefaultWatchInterval if zero.
+// file is loaded by LoadConfig, so KLYN_* environment variables still override it.
+// config failed to load or reload is logged and old one is kept.
+// watching stops when stop is called or logger closed.
+func (kl *KlynLog) WatchConfig(path string, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = consts.DefaultWatchInterval
+	}
+
+	stopChan := make(chan struct{})
+	last, _ := os.Stat(path)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-kl.done:
+				return
+			case <-stopChan:
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				// being replaced, check again next tick
+				continue
+			}
+
+			if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+
+			c, err := LoadConfig(path)
+			if err == nil {
+				err = kl.ReloadConfig(c)
+			}
+
+			if err != nil {
+				log.Printf("klynlog: reload config %s failed:%v", path, err)
+			}
+		}
+	}()
+
+	once := new(sync.Once)
+	return func() {
+		once.Do(func() { close(stopChan) })
+	}
+}
@@ -0,0 +1,342 @@
+package klynlog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+// closeSink - memorySink remembering whether it is closed
+type closeSink struct {
+	memorySink
+	closed int32
+}
+
+func (cs *closeSink) Close() error {
+	atomic.StoreInt32(&cs.closed, 1)
+	return nil
+}
+
+func (cs *closeSink) len() int {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	return len(cs.entries)
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	before, after := new(closeSink), new(closeSink)
+	logger := NewLogger(&LoggerConfig{
+		Prefix:    "KLYN",
+		Dir:       dir,
+		FlushMode: consts.FlushModeByDuration,
+		Sinks:     []Sink{before},
+	}).(*KlynLog)
+
+	logger.Info("cached")
+	logger.Debug("cached")
+
+	err = logger.Reload(&LoggerConfig{
+		Prefix:    "RELOADED",
+		Dir:       dir,
+		Level:     LoggerLevelWarn,
+		FlushMode: consts.FlushModeEveryLog,
+		Encoder:   JSONEncoder{},
+		Sinks:     []Sink{after},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cached records flushed into old sink and file before swapped
+	if before.len() != 2 || atomic.LoadInt32(&before.closed) != 1 {
+		t.Fatalf("want 2 entries in closed old sink, got %d closed %d", before.len(), before.closed)
+	}
+
+	logger.Info("discarded")
+	logger.Error("written")
+
+	day := time.Now().Format(consts.LogFileDateFormat)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "RELOADED-"+day+".log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(b)), "\n"); len(lines) != 1 ||
+		!strings.HasSuffix(lines[0], `"level":"error","message":"written"}`) {
+		t.Fatalf("unexpected reloaded log:\n%s", b)
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(dir, "KLYN-"+day+".log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "message:\"cached\""); n != 2 {
+		t.Fatalf("want 2 cached records in old log file, got:\n%s", b)
+	}
+
+	if after.len() != 1 {
+		t.Fatalf("want 1 entry in new sink, got %d", after.len())
+	}
+
+	if err = logger.Reload(&LoggerConfig{Dir: dir, SpoolPath: filepath.Join(dir, "klyn.spool")}); err == nil {
+		t.Fatal("want error of reloaded SpoolPath")
+	}
+
+	if err = logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = logger.Reload(&LoggerConfig{Dir: dir}); err != errLoggerClosed {
+		t.Fatalf("want %v, got %v", errLoggerClosed, err)
+	}
+}
+
+func TestReloadWhileLogging(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink := new(closeSink)
+	conf := &LoggerConfig{Prefix: "KLYN", Dir: dir, FlushMode: consts.FlushModeBySize, Sinks: []Sink{sink}}
+	logger := NewLogger(conf).(*KlynLog)
+
+	const writers, records = 4, 500
+	wg := new(sync.WaitGroup)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < records; j++ {
+				logger.Info(map[string]interface{}{"writer": i, "record": j})
+			}
+		}(i)
+	}
+
+	modes := []int{consts.FlushModeEveryLog, consts.FlushModeByDuration, consts.FlushModeBySize}
+	for i := 0; i < 30; i++ {
+		c := *conf
+		c.FlushMode = modes[i%len(modes)]
+		if err = logger.Reload(&c); err != nil {
+			t.Fatal(err)
+		}
+		logger.SetLevel(LoggerLevelTrace)
+	}
+
+	wg.Wait()
+	if err = logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// no record is lost while swapped
+	if n := sink.len(); n != writers*records {
+		t.Fatalf("want %d entries in sink, got %d", writers*records, n)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "KLYN-"+time.Now().Format(consts.LogFileDateFormat)+".log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "\n"); n != writers*records {
+		t.Fatalf("want %d lines in log file, got %d", writers*records, n)
+	}
+}
+
+// blockSink - closeSink whose Write waits until release is closed, failed once closed
+type blockSink struct {
+	closeSink
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (bs *blockSink) Write(entries []*Entry) error {
+	close(bs.entered)
+	<-bs.release
+	return bs.closeSink.Write(entries)
+}
+
+func (cs *closeSink) Write(entries []*Entry) error {
+	if atomic.LoadInt32(&cs.closed) == 1 {
+		return fmt.Errorf("sink closed")
+	}
+
+	return cs.memorySink.Write(entries)
+}
+
+func TestReloadWaitsFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := &blockSink{entered: make(chan struct{}), release: make(chan struct{})}
+	second := new(closeSink)
+	logger := NewLogger(&LoggerConfig{
+		Prefix:    "KLYN",
+		Dir:       dir,
+		FlushMode: consts.FlushModeBySize,
+		Sinks:     []Sink{first, second},
+	}).(*KlynLog)
+	defer logger.Close()
+
+	logger.Info("cached")
+	flushed := make(chan error, 1)
+	go func() { flushed <- logger.Flush() }()
+	<-first.entered
+
+	// flush loaded old config and is writing its sinks
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- logger.Reload(&LoggerConfig{Prefix: "KLYN", Dir: dir}) }()
+
+	select {
+	case err = <-reloaded:
+		t.Fatalf("reload returned while flush in progress: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(first.release)
+	if err = <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	if err = <-reloaded; err != nil {
+		t.Fatal(err)
+	}
+
+	if first.len() != 1 || second.len() != 1 {
+		t.Fatalf("want 1 entry in each old sink, got %d and %d", first.len(), second.len())
+	}
+	if n := atomic.LoadUint64(&logger.counters.sinkErrors); n != 0 {
+		t.Fatalf("want no sink error, got %d", n)
+	}
+	if atomic.LoadInt32(&second.closed) != 1 {
+		t.Fatal("want old sink closed")
+	}
+}
+
+func TestSampling(t *testing.T) {
+	s := newSampler(&Sampling{Initial: 2, Thereafter: 3})
+	now := time.Now()
+
+	var kept []int
+	for i := 1; i <= 10; i++ {
+		if s.sample(LoggerLevelInfo, now) {
+			kept = append(kept, i)
+		}
+	}
+	if fmt.Sprint(kept) != "[1 2 5 8]" {
+		t.Fatalf("want [1 2 5 8] kept, got %v", kept)
+	}
+
+	// levels counted apart, and again in next tick
+	if !s.sample(LoggerLevelError, now) || !s.sample(LoggerLevelInfo, now.Add(consts.DefaultSamplingTick)) {
+		t.Fatal("want first record of level and tick kept")
+	}
+
+	s = newSampler(&Sampling{Initial: 1})
+	if !s.sample(LoggerLevelInfo, now) || s.sample(LoggerLevelInfo, now) || s.sample(LoggerLevelInfo, now) {
+		t.Fatal("want only first record kept without thereafter")
+	}
+}
+
+func TestReloadConfigKeepsSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &Config{
+		Dir: dir,
+		Sinks: []SinkConfig{
+			{Type: "http", URL: "http://127.0.0.1:1/_bulk", Format: "ndjson", BatchWait: Duration(time.Hour)},
+			{Type: "http", URL: "http://127.0.0.1:2/_bulk", Format: "ndjson", BatchWait: Duration(time.Hour)},
+		},
+	}
+	logger, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	old := logger.conf().Sinks
+	reloaded := &Config{
+		Dir:      dir,
+		Level:    "warn",
+		Sampling: SamplingConfig{Initial: 10},
+		Sinks:    []SinkConfig{c.Sinks[1], c.Sinks[0]},
+	}
+	reloaded.Sinks[0].BatchSize = 10
+
+	if err = logger.ReloadConfig(reloaded); err != nil {
+		t.Fatal(err)
+	}
+
+	sinks := logger.conf().Sinks
+	if len(sinks) != 2 || sinks[0] == old[1] || sinks[1] != old[0] {
+		t.Fatal("want sink of unchanged config kept and changed one created")
+	}
+	if logger.Level() != LoggerLevelWarn || logger.load().sampler == nil {
+		t.Fatal("want level and sampling reloaded")
+	}
+
+	reloaded.Level = "verbose"
+	if err = logger.ReloadConfig(reloaded); err == nil {
+		t.Fatal("want invalid config rejected")
+	}
+	if logger.Level() != LoggerLevelWarn {
+		t.Fatal("want old config kept after invalid one")
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "klyn.yaml")
+	if err = ioutil.WriteFile(path, []byte("dir: "+dir+"\nlevel: info\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := NewLoggerFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	stop := logger.WatchConfig(path, 10*time.Millisecond)
+	defer stop()
+
+	if err = ioutil.WriteFile(path, []byte("dir: "+dir+"\nlevel: error\nflush:\n  mode: size\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for logger.Level() != LoggerLevelError {
+		if time.Now().After(deadline) {
+			t.Fatal("config file not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if mode := logger.conf().FlushMode; mode != consts.FlushModeBySize {
+		t.Fatalf("want flush mode %d, got %d", consts.FlushModeBySize, mode)
+	}
+}
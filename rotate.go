@@ -0,0 +1,88 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+// log file of a day is PREFIX-2006-01-02.log, once it reaches LoggerConfig.MaxFileSize
+// it is renamed to PREFIX-2006-01-02.N.log, N starts from 1, and a new one is opened.
+
+func logFileName(dir, prefix, day string) string {
+	return fmt.Sprintf("%s/%s-%s.log", dir, prefix, day)
+}
+
+// parseLogFileName - day and rotated sequence of name, seq is 0 for file being written
+func parseLogFileName(name, prefix string) (day time.Time, seq int, ok bool) {
+	if !strings.HasPrefix(name, prefix+"-") || !strings.HasSuffix(name, ".log") {
+		return
+	}
+
+	date := strings.TrimSuffix(strings.TrimPrefix(name, prefix+"-"), ".log")
+	if i := strings.IndexByte(date, '.'); i >= 0 {
+		n, err := strconv.Atoi(date[i+1:])
+		if err != nil || n <= 0 {
+			return
+		}
+		date, seq = date[:i], n
+	}
+
+	day, err := time.ParseInLocation(consts.LogFileDateFormat, date, time.Local)
+	if err != nil {
+		return
+	}
+
+	return day, seq, true
+}
+
+// rotateLogFile - rename log file of day to next rotated name
+func rotateLogFile(dir, prefix, day string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var last int
+	for _, info := range infos {
+		d, seq, ok := parseLogFileName(info.Name(), prefix)
+		if ok && d.Format(consts.LogFileDateFormat) == day && seq > last {
+			last = seq
+		}
+	}
+
+	rotated := fmt.Sprintf("%s/%s-%s.%d.log", dir, prefix, day, last+1)
+	return os.Rename(logFileName(dir, prefix, day), rotated)
+}
+
+// removeExpiredLogFiles - remove log files of prefix whose day ended more than maxAge ago
+func removeExpiredLogFiles(dir, prefix string, maxAge time.Duration) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	expire := time.Now().Add(-maxAge)
+	for _, info := range infos {
+		day, _, ok := parseLogFileName(info.Name(), prefix)
+		if !ok || !day.AddDate(0, 0, 1).Before(expire) {
+			continue
+		}
+
+		if err = os.Remove(filepath.Join(dir, info.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+// Sampling - in every Tick, first Initial records of a level are logged,
+// then every Thereafter-th of them. rest are discarded before redaction and hooks
+type Sampling struct {
+	Tick       time.Duration // consts.DefaultSamplingTick if zero
+	Initial    int
+	Thereafter int // all discarded after Initial if zero
+}
+
+// sampler - counts of current tick, per level
+type sampler struct {
+	conf   Sampling
+	lock   sync.Mutex
+	start  time.Time
+	counts map[Level]int
+}
+
+func newSampler(s *Sampling) *sampler {
+	conf := *s
+	if conf.Tick <= 0 {
+		conf.Tick = consts.DefaultSamplingTick
+	}
+
+	return &sampler{conf: conf, counts: make(map[Level]int)}
+}
+
+// sample - whether record of level logged at now is kept
+func (s *sampler) sample(l Level, now time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if now.Sub(s.start) >= s.conf.Tick {
+		s.start = now
+		s.counts = make(map[Level]int, len(s.counts))
+	}
+
+	s.counts[l]++
+	n := s.counts[l]
+	if n <= s.conf.Initial {
+		return true
+	}
+
+	return s.conf.Thereafter > 0 && (n-s.conf.Initial)%s.conf.Thereafter == 0
+}
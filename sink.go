@@ -0,0 +1,13 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+// Sink - destination entries are delivered to in addition to log file.
+// Write is called on every flush of cache, or every log in FlushModeEveryLog,
+// so it should not block for long.
+type Sink interface {
+	Write(entries []*Entry) error
+	Close() error
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// spool - append-only write-ahead file of cached records.
+// on flush the file is renamed to path.<seq> and a new one is opened,
+// the renamed file is removed once its records are written to log file and sinks.
+// records of files left by a crash are replayed on next start.
+type spool struct {
+	path string
+	file *os.File
+	seq  int
+}
+
+// spoolLine - one record per line, time and level are kept exactly rather than formatted
+type spoolLine struct {
+	Prefix  string              `json:"prefix"`
+	Time    time.Time           `json:"time"`
+	Level   Level               `json:"level"`
+	Message jsoniter.RawMessage `json:"message"`
+}
+
+func openSpool(path string) (*spool, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spool{path: path, file: file}
+	// files not replayed are kept, never overwrite them
+	if rotated, err := spoolFiles(path); err == nil {
+		for _, name := range rotated {
+			if seq, err := strconv.Atoi(strings.TrimPrefix(name, path+".")); err == nil && seq > s.seq {
+				s.seq = seq
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func (s *spool) write(e *Entry) error {
+	msg, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(spoolLine{Prefix: e.Prefix, Time: e.Time, Level: e.Level, Message: msg})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.file.Write(append(b, '\n'))
+	return err
+}
+
+// rotate - move records written so far aside, name of moved file is returned
+// and should be passed to remove after records are flushed
+func (s *spool) rotate() (string, error) {
+	s.seq++
+	name := fmt.Sprintf("%s.%d", s.path, s.seq)
+	if err := os.Rename(s.path, name); err != nil {
+		return "", err
+	}
+
+	if err := s.file.Close(); err != nil {
+		return name, err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return name, err
+	}
+
+	s.file = file
+	return name, nil
+}
+
+func (s *spool) remove(name string) error {
+	return os.Remove(name)
+}
+
+func (s *spool) close() error {
+	return s.file.Close()
+}
+
+// spoolFiles - files left at path, rotated ones by sequence and then path itself
+func spoolFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	seqs := make(map[string]int)
+	var files []string
+	for _, m := range matches {
+		seq, err := strconv.Atoi(strings.TrimPrefix(m, path+"."))
+		if err != nil {
+			continue
+		}
+
+		seqs[m] = seq
+		files = append(files, m)
+	}
+	sort.Slice(files, func(i, j int) bool { return seqs[files[i]] < seqs[files[j]] })
+
+	if _, err = os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+
+	return files, nil
+}
+
+// readSpool - entries of file, a line partly written by a crash is skipped
+func readSpool(name string) ([]*Entry, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for _, raw := range bytes.Split(b, []byte("\n")) {
+		var line spoolLine
+		if len(raw) == 0 || json.Unmarshal(raw, &line) != nil {
+			continue
+		}
+
+		var data interface{}
+		dec := json.NewDecoder(bytes.NewReader(line.Message))
+		dec.UseNumber()
+		if dec.Decode(&data) != nil {
+			continue
+		}
+
+		entries = append(entries, &Entry{Prefix: line.Prefix, Time: line.Time, Level: line.Level, Data: data})
+	}
+
+	return entries, nil
+}
+
+// replaySpool - write records left in spool files by a crash into log file and sinks, then remove the files
+func (kl *KlynLog) replaySpool(path string) error {
+	files, err := spoolFiles(path)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		entries, err := readSpool(name)
+		if err != nil {
+			return err
+		}
+
+		buf := new(bytes.Buffer)
+		for _, e := range entries {
+			if line, err := kl.encoder().Encode(e); err == nil {
+				buf.Write(line)
+			}
+		}
+
+		if buf.Len() > 0 {
+			if err = kl.writeToIO(buf.Bytes(), len(entries), kl.conf().Durability != consts.DurabilityNone); err != nil {
+				return err
+			}
+		}
+		kl.writeToSinks(entries)
+
+		if err = os.Remove(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
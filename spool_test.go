@@ -0,0 +1,211 @@
+package klynlog
+
+import (
+	stdjson "encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yusank/klyn-log/consts"
+)
+
+type memorySink struct {
+	lock    sync.Mutex
+	entries []*Entry
+}
+
+func (ms *memorySink) Write(entries []*Entry) error {
+	ms.lock.Lock()
+	ms.entries = append(ms.entries, entries...)
+	ms.lock.Unlock()
+	return nil
+}
+
+func (ms *memorySink) Close() error {
+	return nil
+}
+
+func TestSpoolReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spoolPath := filepath.Join(dir, "spool", "klyn.spool")
+
+	prefix := fmt.Sprintf("spool%d", time.Now().UnixNano())
+	fileName := fmt.Sprintf("%s/%s-%s.log", consts.DefaultLogDir, prefix, time.Now().Format(consts.LogFileDateFormat))
+	defer os.Remove(fileName)
+
+	crashed := NewLogger(&LoggerConfig{
+		Prefix:    prefix,
+		FlushMode: consts.FlushModeBySize,
+		SpoolPath: spoolPath,
+	})
+	crashed.Warn(map[string]interface{}{"userId": 1})
+	crashed.Any(Level(100), "custom")
+	// records are in cache only, crash before flushed
+
+	b, err := ioutil.ReadFile(spoolPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "\n"); n != 2 {
+		t.Fatalf("want 2 spooled records, got %d:\n%s", n, b)
+	}
+
+	sink := new(memorySink)
+	logger := NewLogger(&LoggerConfig{
+		Prefix:    prefix,
+		FlushMode: consts.FlushModeBySize,
+		SpoolPath: spoolPath,
+		Sinks:     []Sink{sink},
+	}).(*KlynLog)
+
+	if len(sink.entries) != 2 {
+		t.Fatalf("want 2 replayed entries, got %d", len(sink.entries))
+	}
+
+	e := sink.entries[0]
+	if e.Prefix != prefix || e.Level != LoggerLevelWarn ||
+		!reflect.DeepEqual(e.Data, map[string]interface{}{"userId": stdjson.Number("1")}) {
+		t.Fatalf("unexpected replayed entry %+v", e)
+	}
+	if e = sink.entries[1]; e.Level != Level(100) || e.Data != "custom" {
+		t.Fatalf("unexpected replayed entry %+v", e)
+	}
+
+	logged, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(logged), ` | LEVEL:warn | message:{"userId":1}`) {
+		t.Fatalf("replayed records not in log file:\n%s", logged)
+	}
+
+	// flushed records leave spool
+	logger.Info("after restart")
+	if err = logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := spoolFiles(spoolPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != spoolPath {
+		t.Fatalf("want only %s left, got %v", spoolPath, files)
+	}
+	if b, _ = ioutil.ReadFile(spoolPath); len(b) != 0 {
+		t.Fatalf("want empty spool, got %s", b)
+	}
+}
+
+func TestSpoolFilesOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "klyn.spool")
+	for _, name := range []string{path, path + ".10", path + ".2", path + ".tmp"} {
+		if err = ioutil.WriteFile(name, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := spoolFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{path + ".2", path + ".10", path}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("want %v, got %v", want, files)
+	}
+
+	s, err := openSpool(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	// files left are never overwritten by rotate
+	if name, err := s.rotate(); err != nil || name != path+".11" {
+		t.Fatalf("want %s.11, got %s, %v", path, name, err)
+	}
+}
+
+func TestSpoolKeptOnWriteFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spoolPath := filepath.Join(dir, "klyn.spool")
+
+	// log file can not be opened under a regular file
+	notDir := filepath.Join(dir, "file")
+	if err = ioutil.WriteFile(notDir, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := NewLogger(&LoggerConfig{
+		Prefix:    "SPOOL",
+		Dir:       notDir,
+		FlushMode: consts.FlushModeBySize,
+		SpoolPath: spoolPath,
+	}).(*KlynLog)
+	logger.Info(map[string]interface{}{"userId": 1})
+	if err = logger.Flush(); err == nil {
+		t.Fatal("want error of log file write")
+	}
+	logger.Close()
+
+	files, err := spoolFiles(spoolPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []*Entry
+	for _, name := range files {
+		e, err := readSpool(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e...)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("want record kept in spool for replay, got %d in %v", len(entries), files)
+	}
+}
+
+func TestSpoolWriteFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := NewLogger(&LoggerConfig{
+		Prefix:    "SPOOL",
+		Dir:       dir,
+		FlushMode: consts.FlushModeBySize,
+		SpoolPath: filepath.Join(dir, "klyn.spool"),
+	}).(*KlynLog)
+	defer logger.Close()
+
+	// record can not be spooled
+	logger.cache.getSpool().file.Close()
+	logger.Info("not spooled")
+
+	if s := logger.Stats(); s.SpoolErrors != 1 || s.Written != 1 || s.CacheLength != 0 {
+		t.Fatalf("want record counted and flushed at once, got %+v", s)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats - records and bytes of logger since created
+type Stats struct {
+	Written     uint64    `json:"written"`      // records written into log file
+	Dropped     uint64    `json:"dropped"`      // records discarded by sampling, or failed to redact or encode
+	Bytes       uint64    `json:"bytes"`        // bytes written into log file
+	WriteErrors uint64    `json:"write_errors"` // writes of log file failed
+	SpoolErrors uint64    `json:"spool_errors"` // records failed to append to spool, flushed at once instead
+	CacheLength int       `json:"cache_length"` // bytes cached and not flushed yet
+	LastFlush   time.Time `json:"last_flush"`   // last write into log file, zero if never
+	SinkErrors  uint64    `json:"sink_errors"`  // deliveries to sinks failed
+	SinkDropped uint64    `json:"sink_dropped"` // records dropped by sinks counting them, like NetSink and HTTPSink
+	Sync        SyncStats `json:"sync"`
+}
+
+// logStats - counters of Stats, updated atomically
+type logStats struct {
+	written     uint64
+	dropped     uint64
+	bytes       uint64
+	writeErrors uint64
+	spoolErrors uint64
+	sinkErrors  uint64
+	lastFlush   int64 // unix nano
+}
+
+func (ls *logStats) wrote(records, bytes int) {
+	atomic.AddUint64(&ls.written, uint64(records))
+	atomic.AddUint64(&ls.bytes, uint64(bytes))
+	atomic.StoreInt64(&ls.lastFlush, time.Now().UnixNano())
+}
+
+// Stats - records and bytes of logger since created
+func (kl *KlynLog) Stats() Stats {
+	s := Stats{
+		Written:     atomic.LoadUint64(&kl.counters.written),
+		Dropped:     atomic.LoadUint64(&kl.counters.dropped),
+		Bytes:       atomic.LoadUint64(&kl.counters.bytes),
+		WriteErrors: atomic.LoadUint64(&kl.counters.writeErrors),
+		SpoolErrors: atomic.LoadUint64(&kl.counters.spoolErrors),
+		CacheLength: kl.cache.length(),
+		SinkErrors:  atomic.LoadUint64(&kl.counters.sinkErrors),
+		Sync:        kl.SyncStats(),
+	}
+
+	if ts := atomic.LoadInt64(&kl.counters.lastFlush); ts != 0 {
+		s.LastFlush = time.Unix(0, ts)
+	}
+
+	for _, sink := range kl.conf().Sinks {
+		if d, ok := sink.(interface{ Dropped() uint64 }); ok {
+			s.SinkDropped += d.Dropped()
+		}
+	}
+
+	return s
+}
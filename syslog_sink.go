@@ -0,0 +1,235 @@
+// Copyright 2018 Yusan Kurban. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package klynlog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SyslogFormat - syslog message format
+type SyslogFormat int
+
+const (
+	// SyslogRFC5424 - <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD-ID fields] MSG
+	SyslogRFC5424 SyslogFormat = iota
+	// SyslogRFC3164 - <PRI>Jan _2 15:04:05 HOSTNAME APP-NAME[PROCID]: MSG, fields are only in MSG
+	SyslogRFC3164
+)
+
+// SyslogFacility - syslog facility
+type SyslogFacility int
+
+// syslog facilities
+const (
+	SyslogKern SyslogFacility = iota
+	SyslogUser
+	SyslogMail
+	SyslogDaemon
+	SyslogAuth
+	SyslogSyslog
+	SyslogLpr
+	SyslogNews
+	SyslogUucp
+	SyslogCron
+	SyslogAuthpriv
+	SyslogFtp
+	_
+	_
+	_
+	_
+	SyslogLocal0
+	SyslogLocal1
+	SyslogLocal2
+	SyslogLocal3
+	SyslogLocal4
+	SyslogLocal5
+	SyslogLocal6
+	SyslogLocal7
+)
+
+// syslog severities
+const (
+	syslogEmerg = iota
+	syslogAlert
+	syslogCrit
+	syslogErr
+	syslogWarning
+	syslogNotice
+	syslogInfo
+	syslogDebug
+)
+
+const (
+	// DefaultSyslogAddr - local syslog daemon socket
+	DefaultSyslogAddr = "/dev/log"
+	// DefaultSyslogSDID - SD-ID of structured data element carrying fields
+	DefaultSyslogSDID = "klyn@32473"
+)
+
+// SyslogSeverity - syslog severity of level, custom levels are notice
+func SyslogSeverity(l Level) int {
+	switch l {
+	case LoggerLevelTrace, LoggerLevelDebug:
+		return syslogDebug
+	case LoggerLevelInfo:
+		return syslogInfo
+	case LoggerLevelWarn:
+		return syslogWarning
+	case LoggerLevelError:
+		return syslogErr
+	case LoggerLevelFatal:
+		return syslogCrit
+	default:
+		return syslogNotice
+	}
+}
+
+// SyslogEncoder - encode entry into a syslog message
+type SyslogEncoder struct {
+	Format   SyslogFormat
+	Facility SyslogFacility
+	AppName  string // Entry.Prefix if empty, which is LoggerConfig.Prefix
+	Hostname string // os.Hostname if empty
+	SDID     string // DefaultSyslogSDID if empty, RFC5424 only
+}
+
+// Encode - implement Encoder
+func (se *SyslogEncoder) Encode(e *Entry) ([]byte, error) {
+	data, err := jsonValue(e.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, ok := data.(string)
+	if !ok {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		msg = string(b)
+	}
+
+	appName := se.AppName
+	if appName == "" {
+		appName = e.Prefix
+	}
+
+	hostname := se.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	pri := int(se.Facility)*8 + SyslogSeverity(e.Level)
+	buf := new(bytes.Buffer)
+	if se.Format == SyslogRFC3164 {
+		fmt.Fprintf(buf, "<%d>%s %s %s[%d]: %s\n", pri, e.Time.Format("Jan _2 15:04:05"),
+			syslogHeaderField(hostname, 255), syslogHeaderField(appName, 32), os.Getpid(), msg)
+		return buf.Bytes(), nil
+	}
+
+	fmt.Fprintf(buf, "<%d>1 %s %s %s %d %s ", pri, e.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(hostname, 255), syslogHeaderField(appName, 48), os.Getpid(), e.Level.String())
+	se.writeStructuredData(buf, data)
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// writeStructuredData - one element with a param per field, nested fields have dotted names
+func (se *SyslogEncoder) writeStructuredData(buf *bytes.Buffer, data interface{}) {
+	m, ok := data.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		buf.WriteByte('-')
+		return
+	}
+
+	sdID := se.SDID
+	if sdID == "" {
+		sdID = DefaultSyslogSDID
+	}
+
+	buf.WriteByte('[')
+	buf.WriteString(syslogName(sdID))
+	walkFields("", m, func(key string, v interface{}) {
+		buf.WriteByte(' ')
+		buf.WriteString(syslogName(key))
+		buf.WriteString(`="`)
+		syslogParamEscaper.WriteString(buf, fieldString(v))
+		buf.WriteByte('"')
+	})
+	buf.WriteByte(']')
+}
+
+var syslogParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// syslogHeaderField - printable ascii without space, "-" if empty
+func syslogHeaderField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+
+	if s == "" {
+		return "-"
+	}
+
+	if len(s) > max {
+		s = s[:max]
+	}
+
+	return s
+}
+
+// syslogName - SD-NAME is printable ascii except '=', ' ', ']', '"', at most 32 chars
+func syslogName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, syslogHeaderField(s, 32))
+
+	return s
+}
+
+// SyslogConfig - syslog sink config
+type SyslogConfig struct {
+	SyslogEncoder
+
+	// Network - unixgram, unix, udp or tcp. unixgram if empty and Addr is empty
+	Network string
+	// Addr - host:port or unix socket path, DefaultSyslogAddr if empty
+	Addr string
+
+	// Net - spool, timeouts and backoff of underlying NetSink, Network, Addr, Encoder and Framing are ignored
+	Net NetSinkConfig
+}
+
+// NewSyslogSink - sink sends entries to syslog, over tcp messages are framed by octet counting of RFC 6587
+func NewSyslogSink(conf *SyslogConfig) (*NetSink, error) {
+	nc := conf.Net
+	nc.Network, nc.Addr = conf.Network, conf.Addr
+	if nc.Addr == "" {
+		nc.Addr = DefaultSyslogAddr
+		if nc.Network == "" {
+			nc.Network = "unixgram"
+		}
+	}
+
+	enc := conf.SyslogEncoder
+	nc.Encoder = &enc
+	nc.Framing = FramingNewline
+	if strings.HasPrefix(nc.Network, "tcp") {
+		nc.Framing = FramingOctetCounting
+	}
+
+	return NewNetSink(&nc)
+}
@@ -0,0 +1,211 @@
+package klynlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func syslogEntry(data interface{}) *Entry {
+	return &Entry{
+		Prefix: "KLYN",
+		Time:   time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC),
+		Level:  LoggerLevelWarn,
+		Data:   data,
+	}
+}
+
+func TestSyslogEncoderRFC5424(t *testing.T) {
+	enc := &SyslogEncoder{Facility: SyslogLocal0, Hostname: "host1"}
+	b, err := enc.Encode(syslogEntry(map[string]interface{}{
+		"userId": 1,
+		"event":  map[string]interface{}{"name": `a "b" ]c\`},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// local0 * 8 + warning
+	want := fmt.Sprintf(`<132>1 2018-06-01T10:00:00.000000Z host1 KLYN %d warn `+
+		`[klyn@32473 event.name="a \"b\" \]c\\" userId="1"] {"event":{"name":"a \"b\" ]c\\"},"userId":1}`+"\n", os.Getpid())
+	if string(b) != want {
+		t.Fatalf("want %s, got %s", want, b)
+	}
+
+	b, err = enc.Encode(syslogEntry("plain message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = fmt.Sprintf("<132>1 2018-06-01T10:00:00.000000Z host1 KLYN %d warn - plain message\n", os.Getpid())
+	if string(b) != want {
+		t.Fatalf("want %s, got %s", want, b)
+	}
+}
+
+func TestSyslogEncoderRFC3164(t *testing.T) {
+	enc := &SyslogEncoder{Format: SyslogRFC3164, Facility: SyslogUser, Hostname: "host1", AppName: "my app"}
+	e := syslogEntry(map[string]interface{}{"userId": 1})
+	e.Level = LoggerLevelError
+
+	b, err := enc.Encode(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := fmt.Sprintf(`<11>Jun  1 10:00:00 host1 my_app[%d]: {"userId":1}`+"\n", os.Getpid())
+	if string(b) != want {
+		t.Fatalf("want %s, got %s", want, b)
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	cases := map[Level]int{
+		LoggerLevelTrace: 7,
+		LoggerLevelDebug: 7,
+		LoggerLevelInfo:  6,
+		LoggerLevelWarn:  4,
+		LoggerLevelError: 3,
+		LoggerLevelFatal: 2,
+		Level(100):       5,
+	}
+
+	for l, want := range cases {
+		if got := SyslogSeverity(l); got != want {
+			t.Errorf("level %v: want %d, got %d", l, want, got)
+		}
+	}
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	sink, err := NewSyslogSink(&SyslogConfig{
+		SyslogEncoder: SyslogEncoder{Facility: SyslogUser, Hostname: "host1"},
+		Network:       "udp",
+		Addr:          pc.LocalAddr().String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err = sink.Write([]*Entry{syslogEntry("hello")}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64*1024)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(buf[:n]); !strings.HasPrefix(got, "<12>1 ") || !strings.HasSuffix(got, " warn - hello\n") {
+		t.Fatalf("unexpected message %q", got)
+	}
+}
+
+func TestSyslogSinkTCPOctetCounting(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	sink, err := NewSyslogSink(&SyslogConfig{
+		SyslogEncoder: SyslogEncoder{Facility: SyslogUser, Hostname: "host1"},
+		Network:       "tcp",
+		Addr:          l.Addr().String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err = sink.Write([]*Entry{syslogEntry("first"), syslogEntry("second")}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	for _, msg := range []string{"first", "second"} {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b := make([]byte, n)
+		if _, err = io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasSuffix(string(b), " warn - "+msg) {
+			t.Fatalf("unexpected message %q", b)
+		}
+	}
+}
+
+func TestSyslogSinkUnixgram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klyn-syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr := filepath.Join(dir, "log.sock")
+	pc, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skipf("unixgram not supported: %v", err)
+	}
+	defer pc.Close()
+
+	sink, err := NewSyslogSink(&SyslogConfig{
+		SyslogEncoder: SyslogEncoder{Format: SyslogRFC3164, Facility: SyslogUser, Hostname: "host1"},
+		Network:       "unixgram",
+		Addr:          addr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err = sink.Write([]*Entry{syslogEntry("hello")}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64*1024)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := fmt.Sprintf("<12>Jun  1 10:00:00 host1 KLYN[%d]: hello\n", os.Getpid())
+	if got := string(buf[:n]); got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
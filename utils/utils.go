@@ -12,7 +12,7 @@ import (
 func CreateIfNotExist(dirName string) error {
 	_, err := os.Stat(dirName)
 	if os.IsNotExist(err) {
-		return os.Mkdir("logFiles", os.ModePerm)
+		return os.MkdirAll(dirName, os.ModePerm)
 	}
 
 	return err